@@ -0,0 +1,178 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DefaultTagSize is the length of the tags Seal makes, and Open expects, when
+// given a tagSize of 0.
+const DefaultTagSize = 16
+
+// ErrAuthFailed is returned when a message, or the data authenticated along
+// with it, does not match its tag.
+var ErrAuthFailed = errors.New("Message authentication failed")
+
+// aeadParams checks that key, iv and tagSize suit the AEAD cipher c, and
+// returns tagSize, or DefaultTagSize in place of 0.
+func aeadParams(c EVP_CIPHER, key, iv []byte, tagSize int) (int, error) {
+	if c == nil || c.Swigcptr() == 0 {
+		return 0, errors.New("Cipher is not available")
+	}
+	if EVP_CIPHER_flags(c)&EVP_CIPH_FLAG_AEAD_CIPHER == 0 {
+		return 0, errors.New("Cipher does not authenticate")
+	}
+	if n := EVP_CIPHER_key_length(c); len(key) != n {
+		return 0, fmt.Errorf("Key is %d bytes long, not %d", len(key), n)
+	}
+	if tagSize == 0 {
+		tagSize = DefaultTagSize
+	}
+
+	switch EVP_CIPHER_mode(c) {
+	case EVP_CIPH_GCM_MODE:
+		if len(iv) == 0 {
+			return 0, errors.New("IV is empty")
+		}
+		if tagSize < 4 || tagSize > 16 {
+			return 0, fmt.Errorf("GCM tags are 4 to 16 bytes long, not %d", tagSize)
+		}
+	case EVP_CIPH_CCM_MODE:
+		if len(iv) < 7 || len(iv) > 13 {
+			return 0, fmt.Errorf("CCM IVs are 7 to 13 bytes long, not %d", len(iv))
+		}
+		if tagSize < 4 || tagSize > 16 || tagSize%2 != 0 {
+			return 0, fmt.Errorf("CCM tags are 4, 6, 8, 10, 12, 14 or 16 bytes long, not %d", tagSize)
+		}
+	default:
+		/* OpenSSL checks the rest */
+		if len(iv) == 0 {
+			return 0, errors.New("IV is empty")
+		}
+	}
+	return tagSize, nil
+}
+
+// newAEADCtx returns a context which encrypts, if enc is 1, or decrypts, if
+// enc is 0, with the AEAD cipher c, key and iv, and tags tagSize bytes long.
+func newAEADCtx(c EVP_CIPHER, key, iv []byte, tagSize, enc int) (EVP_CIPHER_CTX, error) {
+	ctx := EVP_CIPHER_CTX_new()
+	if ctx == nil || ctx.Swigcptr() == 0 {
+		return nil, NewOpenSSLError("Unable to create a cipher context")
+	}
+
+	/* GCM takes the tag length when the tag is read or set, and no sooner */
+	if EVP_CIPHER_mode(c) == EVP_CIPH_GCM_MODE {
+		tagSize = 0
+	}
+	if EVP_CipherInit_aead(ctx, c, string(key), string(iv), len(iv), tagSize, enc) != 1 {
+		EVP_CIPHER_CTX_free(ctx)
+		return nil, NewOpenSSLError("Unable to set up the cipher")
+	}
+	return ctx, nil
+}
+
+// Seal encrypts and authenticates plaintext with the AEAD cipher c, such as
+// EVP_aes_256_gcm or EVP_aes_128_ccm, key and iv, authenticates aad along
+// with it, and returns the ciphertext followed by a tag tagSize bytes long.
+//
+// GCM takes IVs of any length, of which 12 bytes is the most efficient, and
+// tags of 4 to 16 bytes.  CCM takes IVs of 7 to 13 bytes, each byte fewer
+// doubling the longest message allowed, and tags of an even length from 4 to
+// 16 bytes.  A tagSize of 0 means DefaultTagSize.  An IV must never be used
+// twice with the same key.
+func Seal(c EVP_CIPHER, key, iv, plaintext, aad []byte, tagSize int) ([]byte, error) {
+	tagSize, err := aeadParams(c, key, iv, tagSize)
+	if err != nil {
+		return nil, err
+	}
+	ccm := EVP_CIPHER_mode(c) == EVP_CIPH_CCM_MODE
+
+	var sealed []byte
+	err = WithErrorQueue(func() error {
+		ctx, err := newAEADCtx(c, key, iv, tagSize, 1)
+		if err != nil {
+			return err
+		}
+		defer EVP_CIPHER_CTX_free(ctx)
+
+		if ccm && EVP_CIPHER_CTX_set_msglen(ctx, len(plaintext)) != 1 {
+			return NewOpenSSLError("Unable to set the message length")
+		}
+		if err = cipherAAD(ctx, aad); err != nil {
+			return err
+		}
+		if sealed, err = cipherUpdate(ctx, plaintext); err != nil {
+			return err
+		}
+
+		/* CCM is done with the one update */
+		if !ccm {
+			final, err := cipherFinal(ctx)
+			if err != nil {
+				return err
+			}
+			sealed = append(sealed, final...)
+		}
+
+		tag := make([]byte, tagSize)
+		if GET_TAG_GCM(ctx, EVP_CTRL_AEAD_GET_TAG, len(tag), tag) != 1 {
+			return NewOpenSSLError("Unable to get the tag")
+		}
+		sealed = append(sealed, tag...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sealed, nil
+}
+
+// Open authenticates and decrypts sealed, as returned by Seal with the same
+// c, key, iv, aad and tagSize, and returns the plaintext.  If sealed or aad
+// do not match the tag, it returns ErrAuthFailed, and no plaintext.
+func Open(c EVP_CIPHER, key, iv, sealed, aad []byte, tagSize int) ([]byte, error) {
+	tagSize, err := aeadParams(c, key, iv, tagSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < tagSize {
+		return nil, ErrAuthFailed
+	}
+	ciphertext, tag := sealed[:len(sealed)-tagSize], sealed[len(sealed)-tagSize:]
+	ccm := EVP_CIPHER_mode(c) == EVP_CIPH_CCM_MODE
+
+	var opened []byte
+	err = WithErrorQueue(func() error {
+		ctx, err := newAEADCtx(c, key, iv, tagSize, 0)
+		if err != nil {
+			return err
+		}
+		defer EVP_CIPHER_CTX_free(ctx)
+
+		if SET_TAG_GCM(ctx, EVP_CTRL_AEAD_SET_TAG, len(tag), string(tag)) != 1 {
+			return NewOpenSSLError("Unable to set the tag")
+		}
+		if ccm && EVP_CIPHER_CTX_set_msglen(ctx, len(ciphertext)) != 1 {
+			return NewOpenSSLError("Unable to set the message length")
+		}
+		if err = cipherAAD(ctx, aad); err != nil {
+			return err
+		}
+
+		/* CCM checks the tag as it decrypts, and the others when they finish */
+		opened, err = cipherUpdate(ctx, ciphertext)
+		if err == nil && !ccm {
+			_, err = cipherFinal(ctx)
+		}
+		if err != nil {
+			ERR_clear_error()
+			return ErrAuthFailed
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return opened, nil
+}
@@ -0,0 +1,179 @@
+package crypto_test
+
+import (
+	. "github.com/IBM-Bluemix/golang-openssl-wrapper/crypto"
+
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Authenticated encryption", func() {
+	var (
+		key, plaintext, aad []byte
+	)
+
+	BeforeEach(func() {
+		key = []byte("a 128 bit key...")
+		plaintext = []byte("My super super super super duper long string to be encrypted")
+		aad = []byte("header")
+	})
+
+	unhex := func(s string) []byte {
+		b, e := hex.DecodeString(s)
+		Expect(e).To(BeNil())
+		return b
+	}
+
+	Context("With GCM", func() {
+		var block cipher.Block
+
+		BeforeEach(func() {
+			var e error
+			block, e = aes.NewCipher(key)
+			Expect(e).To(BeNil())
+		})
+
+		It("Takes IVs of other lengths as crypto/cipher does", func() {
+			iv := []byte("sixteen byte iv!")
+			std, e := cipher.NewGCMWithNonceSize(block, len(iv))
+			Expect(e).To(BeNil())
+
+			sealed, e := Seal(EVP_aes_128_gcm(), key, iv, plaintext, aad, 0)
+			Expect(e).To(BeNil())
+			Expect(sealed).To(Equal(std.Seal(nil, iv, plaintext, aad)))
+
+			opened, e := Open(EVP_aes_128_gcm(), key, iv, sealed, aad, 0)
+			Expect(e).To(BeNil())
+			Expect(opened).To(Equal(plaintext))
+		})
+
+		It("Makes shorter tags as crypto/cipher does", func() {
+			iv := []byte("twelve bytes")
+			std, e := cipher.NewGCMWithTagSize(block, 12)
+			Expect(e).To(BeNil())
+
+			sealed, e := Seal(EVP_aes_128_gcm(), key, iv, plaintext, aad, 12)
+			Expect(e).To(BeNil())
+			Expect(sealed).To(Equal(std.Seal(nil, iv, plaintext, aad)))
+
+			opened, e := Open(EVP_aes_128_gcm(), key, iv, sealed, aad, 12)
+			Expect(e).To(BeNil())
+			Expect(opened).To(Equal(plaintext))
+		})
+
+		It("Refuses tags out of range", func() {
+			_, e := Seal(EVP_aes_128_gcm(), key, []byte("twelve bytes"), plaintext, aad, 3)
+			Expect(e).To(HaveOccurred())
+			_, e = Seal(EVP_aes_128_gcm(), key, []byte("twelve bytes"), plaintext, aad, 17)
+			Expect(e).To(HaveOccurred())
+		})
+	})
+
+	Context("With CCM", func() {
+		It("Seals the first packet of RFC 3610", func() {
+			key := unhex("c0c1c2c3c4c5c6c7c8c9cacbcccdcecf")
+			iv := unhex("00000003020100a0a1a2a3a4a5")
+			aad := unhex("0001020304050607")
+			plaintext := unhex("08090a0b0c0d0e0f101112131415161718191a1b1c1d1e")
+			want := unhex("588c979a61c663d2f066d0c2c0f989806d5f6b61dac38417e8d12cfdf926e0")
+
+			sealed, e := Seal(EVP_aes_128_ccm(), key, iv, plaintext, aad, 8)
+			Expect(e).To(BeNil())
+			Expect(sealed).To(Equal(want))
+
+			opened, e := Open(EVP_aes_128_ccm(), key, iv, want, aad, 8)
+			Expect(e).To(BeNil())
+			Expect(opened).To(Equal(plaintext))
+		})
+
+		It("Takes IVs of 7 to 13 bytes and tags of 4 to 16", func() {
+			for _, ivLen := range []int{7, 10, 13} {
+				for _, tagSize := range []int{4, 10, 16} {
+					iv := bytes.Repeat([]byte{byte(ivLen)}, ivLen)
+
+					sealed, e := Seal(EVP_aes_128_ccm(), key, iv, plaintext, aad, tagSize)
+					Expect(e).To(BeNil())
+					Expect(sealed).To(HaveLen(len(plaintext) + tagSize))
+
+					opened, e := Open(EVP_aes_128_ccm(), key, iv, sealed, aad, tagSize)
+					Expect(e).To(BeNil())
+					Expect(opened).To(Equal(plaintext))
+				}
+			}
+		})
+
+		It("Refuses IVs and tags out of range", func() {
+			_, e := Seal(EVP_aes_128_ccm(), key, []byte("6bytes"), plaintext, aad, 0)
+			Expect(e).To(HaveOccurred())
+			_, e = Seal(EVP_aes_128_ccm(), key, []byte("twelve bytes"), plaintext, aad, 5)
+			Expect(e).To(HaveOccurred())
+		})
+	})
+
+	for name, c := range map[string]func() EVP_CIPHER{
+		"GCM":               EVP_aes_128_gcm,
+		"CCM":               EVP_aes_128_ccm,
+		"ChaCha20-Poly1305": EVP_chacha20_poly1305,
+	} {
+		c := c
+
+		Context("When the message was tampered with, with "+name, func() {
+			var (
+				k, iv, sealed []byte
+			)
+
+			BeforeEach(func() {
+				k = bytes.Repeat([]byte{1}, EVP_CIPHER_key_length(c()))
+				iv = []byte("twelve bytes")
+
+				var e error
+				sealed, e = Seal(c(), k, iv, plaintext, aad, 0)
+				Expect(e).To(BeNil())
+			})
+
+			It("Opens the untouched message", func() {
+				opened, e := Open(c(), k, iv, sealed, aad, 0)
+				Expect(e).To(BeNil())
+				Expect(opened).To(Equal(plaintext))
+			})
+
+			It("Fails on a changed ciphertext", func() {
+				sealed[0] ^= 1
+				opened, e := Open(c(), k, iv, sealed, aad, 0)
+				Expect(e).To(Equal(ErrAuthFailed))
+				Expect(opened).To(BeNil())
+			})
+
+			It("Fails on a changed tag", func() {
+				sealed[len(sealed)-1] ^= 1
+				_, e := Open(c(), k, iv, sealed, aad, 0)
+				Expect(e).To(Equal(ErrAuthFailed))
+			})
+
+			It("Fails on other additional data", func() {
+				_, e := Open(c(), k, iv, sealed, []byte("other"), 0)
+				Expect(e).To(Equal(ErrAuthFailed))
+			})
+
+			It("Fails on a message shorter than its tag", func() {
+				_, e := Open(c(), k, iv, sealed[:DefaultTagSize-1], aad, 0)
+				Expect(e).To(Equal(ErrAuthFailed))
+			})
+		})
+	}
+
+	It("Refuses ciphers which do not authenticate", func() {
+		_, e := Seal(EVP_aes_128_cbc(), key, []byte("and a 128 bit iv"), plaintext, aad, 0)
+		Expect(e).To(HaveOccurred())
+	})
+
+	It("Refuses keys of the wrong length", func() {
+		_, e := Seal(EVP_aes_256_gcm(), key, []byte("twelve bytes"), plaintext, aad, 0)
+		Expect(e).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,104 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"runtime"
+	"sync"
+)
+
+// aesCipher is a cipher.Block which runs AES in OpenSSL, a block at a time
+// in ECB mode.
+type aesCipher struct {
+	mu       sync.Mutex
+	enc, dec EVP_CIPHER_CTX
+}
+
+// NewAESCipher returns a cipher.Block which encrypts and decrypts with AES in
+// OpenSSL, for use wherever one from crypto/aes.NewCipher would be.  The key
+// is 16, 24 or 32 bytes long, for AES-128, AES-192 or AES-256.
+func NewAESCipher(key []byte) (cipher.Block, error) {
+	var c EVP_CIPHER
+	switch len(key) {
+	case 16:
+		c = EVP_aes_128_ecb()
+	case 24:
+		c = EVP_aes_192_ecb()
+	case 32:
+		c = EVP_aes_256_ecb()
+	default:
+		return nil, aes.KeySizeError(len(key))
+	}
+
+	b := &aesCipher{}
+	err := WithErrorQueue(func() error {
+		var err error
+		if b.enc, err = newCipherCtx(c, key, nil, 1); err != nil {
+			return err
+		}
+		if b.dec, err = newCipherCtx(c, key, nil, 0); err != nil {
+			return err
+		}
+
+		/* Blocks go in and come out one at a time, with nothing held back */
+		if EVP_CIPHER_CTX_set_padding(b.enc, 0) != 1 || EVP_CIPHER_CTX_set_padding(b.dec, 0) != 1 {
+			return NewOpenSSLError("Unable to turn off padding")
+		}
+		return nil
+	})
+	if err != nil {
+		b.free()
+		return nil, err
+	}
+
+	runtime.SetFinalizer(b, (*aesCipher).free)
+	return b, nil
+}
+
+// BlockSize returns the AES block size, 16 bytes.
+func (b *aesCipher) BlockSize() int {
+	return aes.BlockSize
+}
+
+// Encrypt encrypts the first block of src into dst.
+func (b *aesCipher) Encrypt(dst, src []byte) {
+	b.crypt(b.enc, dst, src)
+}
+
+// Decrypt decrypts the first block of src into dst.
+func (b *aesCipher) Decrypt(dst, src []byte) {
+	b.crypt(b.dec, dst, src)
+}
+
+func (b *aesCipher) crypt(ctx EVP_CIPHER_CTX, dst, src []byte) {
+	if len(src) < aes.BlockSize {
+		panic("crypto: input not full block")
+	}
+	if len(dst) < aes.BlockSize {
+		panic("crypto: output not full block")
+	}
+
+	/*
+	 * OpenSSL writes straight into dst.  The buffer is copied back up to its
+	 * capacity, so that is cut to the one block
+	 */
+	var n int
+	b.mu.Lock()
+	ret := EVP_CipherUpdate(ctx, dst[:aes.BlockSize:aes.BlockSize], &n, string(src[:aes.BlockSize]), aes.BlockSize)
+	b.mu.Unlock()
+
+	if ret != 1 || n != aes.BlockSize {
+		panic("crypto: AES block operation failed")
+	}
+}
+
+func (b *aesCipher) free() {
+	if b.enc != nil {
+		EVP_CIPHER_CTX_free(b.enc)
+		b.enc = nil
+	}
+	if b.dec != nil {
+		EVP_CIPHER_CTX_free(b.dec)
+		b.dec = nil
+	}
+}
@@ -0,0 +1,84 @@
+package crypto_test
+
+import (
+	. "github.com/IBM-Bluemix/golang-openssl-wrapper/crypto"
+
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AES", func() {
+	for _, size := range []int{16, 24, 32} {
+		size := size
+
+		Context(fmt.Sprintf("With a %d bit key", size*8), func() {
+			var (
+				key       []byte
+				ours, std cipher.Block
+			)
+
+			BeforeEach(func() {
+				var e error
+				key = bytes.Repeat([]byte{byte(size)}, size)
+
+				ours, e = NewAESCipher(key)
+				Expect(e).To(BeNil())
+				std, e = aes.NewCipher(key)
+				Expect(e).To(BeNil())
+			})
+
+			It("Encrypts a block as crypto/aes does", func() {
+				src := []byte("sixteen byte blk")
+				want := make([]byte, aes.BlockSize)
+				std.Encrypt(want, src)
+
+				got := make([]byte, aes.BlockSize)
+				ours.Encrypt(got, src)
+				Expect(got).To(Equal(want))
+
+				ours.Decrypt(got, got)
+				Expect(got).To(Equal(src))
+			})
+
+			It("Works with the modes of crypto/cipher", func() {
+				iv := make([]byte, aes.BlockSize)
+				plaintext := bytes.Repeat([]byte("0123456789abcdef"), 4)
+
+				want := make([]byte, len(plaintext))
+				cipher.NewCBCEncrypter(std, iv).CryptBlocks(want, plaintext)
+
+				got := make([]byte, len(plaintext))
+				cipher.NewCBCEncrypter(ours, iv).CryptBlocks(got, plaintext)
+				Expect(got).To(Equal(want))
+
+				cipher.NewCBCDecrypter(ours, iv).CryptBlocks(got, got)
+				Expect(got).To(Equal(plaintext))
+			})
+		})
+	}
+
+	It("Refuses keys of other sizes", func() {
+		_, e := NewAESCipher([]byte("short"))
+		Expect(e).To(Equal(aes.KeySizeError(5)))
+	})
+
+	It("Writes only the first block of dst", func() {
+		b, e := NewAESCipher(make([]byte, 16))
+		Expect(e).To(BeNil())
+
+		dst := bytes.Repeat([]byte{0xff}, 2*aes.BlockSize)
+		b.Encrypt(dst, make([]byte, aes.BlockSize))
+		Expect(dst[aes.BlockSize:]).To(Equal(bytes.Repeat([]byte{0xff}, aes.BlockSize)))
+	})
+
+	It("Panics on short blocks", func() {
+		b, e := NewAESCipher(make([]byte, 16))
+		Expect(e).To(BeNil())
+		Expect(func() { b.Encrypt(make([]byte, 16), make([]byte, 8)) }).To(Panic())
+	})
+})
@@ -0,0 +1,71 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Helpers for driving an EVP_CIPHER_CTX from Go.  They are called from within
+// WithErrorQueue, so the errors they return carry what OpenSSL reported.
+
+// newCipherCtx returns a context which encrypts with c, key and iv if enc is
+// 1, or decrypts with them if enc is 0.  An empty iv leaves it to be set later,
+// or unused.
+func newCipherCtx(c EVP_CIPHER, key, iv []byte, enc int) (EVP_CIPHER_CTX, error) {
+	if c == nil || c.Swigcptr() == 0 {
+		return nil, errors.New("Cipher is not available")
+	}
+
+	/* OpenSSL reads as much key and IV as the cipher takes, whatever we pass */
+	if n := EVP_CIPHER_key_length(c); len(key) != n {
+		return nil, fmt.Errorf("Key is %d bytes long, not %d", len(key), n)
+	}
+	if n := EVP_CIPHER_iv_length(c); len(iv) != 0 && len(iv) != n {
+		return nil, fmt.Errorf("IV is %d bytes long, not %d", len(iv), n)
+	}
+
+	ctx := EVP_CIPHER_CTX_new()
+	if ctx == nil || ctx.Swigcptr() == 0 {
+		return nil, NewOpenSSLError("Unable to create a cipher context")
+	}
+
+	if EVP_CipherInit_ex(ctx, c, SwigcptrStruct_SS_engine_st(0), string(key), string(iv), enc) != 1 {
+		EVP_CIPHER_CTX_free(ctx)
+		return nil, NewOpenSSLError("Unable to set up the cipher")
+	}
+	return ctx, nil
+}
+
+// cipherUpdate feeds in to ctx and returns what ctx puts out for it.
+func cipherUpdate(ctx EVP_CIPHER_CTX, in []byte) ([]byte, error) {
+	/* The buffer is copied back whole, so it must not share memory with the caller's */
+	out := make([]byte, len(in)+EVP_CIPHER_CTX_block_size(ctx))
+	var n int
+	if EVP_CipherUpdate(ctx, out, &n, string(in), len(in)) != 1 {
+		return nil, NewOpenSSLError("Unable to update the cipher")
+	}
+	return out[:n], nil
+}
+
+// cipherAAD feeds aad to an AEAD ctx as data to authenticate but not encrypt.
+func cipherAAD(ctx EVP_CIPHER_CTX, aad []byte) error {
+	if len(aad) == 0 {
+		return nil
+	}
+
+	var n int
+	if EVP_CipherUpdate(ctx, nil, &n, string(aad), len(aad)) != 1 {
+		return NewOpenSSLError("Unable to add authenticated data")
+	}
+	return nil
+}
+
+// cipherFinal finishes ctx and returns what it still held back.
+func cipherFinal(ctx EVP_CIPHER_CTX) ([]byte, error) {
+	out := make([]byte, EVP_CIPHER_CTX_block_size(ctx))
+	var n int
+	if EVP_CipherFinal_ex(ctx, out, &n) != 1 {
+		return nil, NewOpenSSLError("Unable to finish the cipher")
+	}
+	return out[:n], nil
+}
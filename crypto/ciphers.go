@@ -0,0 +1,23 @@
+package crypto
+
+import (
+	"fmt"
+	"sync"
+)
+
+var addCiphersOnce sync.Once
+
+// CipherByName returns the cipher OpenSSL knows by name, such as
+// "aes-128-ctr" or "chacha20-poly1305", for use wherever an EVP_CIPHER from
+// the EVP_* functions would be.  EVP_CIPHER_key_length, EVP_CIPHER_iv_length,
+// EVP_CIPHER_block_size and EVP_CIPHER_mode describe it.
+func CipherByName(name string) (EVP_CIPHER, error) {
+	/* OpenSSL 1.0.2 knows ciphers by name only once they are added */
+	addCiphersOnce.Do(OpenSSL_add_all_algorithms)
+
+	c := EVP_get_cipherbyname(name)
+	if c == nil || c.Swigcptr() == 0 {
+		return nil, fmt.Errorf("Unknown cipher %q", name)
+	}
+	return c, nil
+}
@@ -0,0 +1,141 @@
+package crypto_test
+
+import (
+	. "github.com/IBM-Bluemix/golang-openssl-wrapper/crypto"
+
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"io"
+	"io/ioutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Ciphers", func() {
+	type info struct {
+		cipher                   EVP_CIPHER
+		keyLen, ivLen, blockSize int
+		mode                     int
+	}
+
+	It("Describes the AES modes", func() {
+		for name, want := range map[string]info{
+			"aes-128-ecb":    {EVP_aes_128_ecb(), 16, 0, 16, EVP_CIPH_ECB_MODE},
+			"aes-192-cbc":    {EVP_aes_192_cbc(), 24, 16, 16, EVP_CIPH_CBC_MODE},
+			"aes-256-ctr":    {EVP_aes_256_ctr(), 32, 16, 1, EVP_CIPH_CTR_MODE},
+			"aes-128-ofb":    {EVP_aes_128_ofb(), 16, 16, 1, EVP_CIPH_OFB_MODE},
+			"aes-192-cfb8":   {EVP_aes_192_cfb8(), 24, 16, 1, EVP_CIPH_CFB_MODE},
+			"aes-256-cfb128": {EVP_aes_256_cfb128(), 32, 16, 1, EVP_CIPH_CFB_MODE},
+			"aes-128-gcm":    {EVP_aes_128_gcm(), 16, 12, 1, EVP_CIPH_GCM_MODE},
+			"aes-192-ccm":    {EVP_aes_192_ccm(), 24, 12, 1, EVP_CIPH_CCM_MODE},
+			"aes-128-xts":    {EVP_aes_128_xts(), 32, 16, 1, EVP_CIPH_XTS_MODE},
+			"aes-256-xts":    {EVP_aes_256_xts(), 64, 16, 1, EVP_CIPH_XTS_MODE},
+		} {
+			c := want.cipher
+			Expect(c.Swigcptr()).NotTo(BeZero(), name)
+			Expect(info{c, EVP_CIPHER_key_length(c), EVP_CIPHER_iv_length(c), EVP_CIPHER_block_size(c), EVP_CIPHER_mode(c)}).To(Equal(want), name)
+		}
+	})
+
+	It("Describes OCB", func() {
+		c := EVP_aes_256_ocb()
+		Expect(EVP_CIPHER_key_length(c)).To(Equal(32))
+		Expect(EVP_CIPHER_iv_length(c)).To(Equal(12))
+		Expect(EVP_CIPHER_mode(c)).To(Equal(EVP_CIPH_OCB_MODE))
+	})
+
+	It("Describes ChaCha20", func() {
+		Expect(EVP_CIPHER_key_length(EVP_chacha20())).To(Equal(32))
+		Expect(EVP_CIPHER_iv_length(EVP_chacha20())).To(Equal(16))
+
+		Expect(EVP_CIPHER_key_length(EVP_chacha20_poly1305())).To(Equal(32))
+		Expect(EVP_CIPHER_iv_length(EVP_chacha20_poly1305())).To(Equal(12))
+		Expect(EVP_CIPHER_flags(EVP_chacha20_poly1305()) & EVP_CIPH_FLAG_AEAD_CIPHER).NotTo(BeZero())
+	})
+
+	Context("By name", func() {
+		It("Finds the ciphers of the catalog", func() {
+			for name, c := range map[string]EVP_CIPHER{
+				"aes-128-ctr":       EVP_aes_128_ctr(),
+				"aes-256-cbc":       EVP_aes_256_cbc(),
+				"aes-256-xts":       EVP_aes_256_xts(),
+				"chacha20-poly1305": EVP_chacha20_poly1305(),
+			} {
+				found, e := CipherByName(name)
+				Expect(e).To(BeNil(), name)
+				Expect(EVP_CIPHER_name(found)).To(Equal(EVP_CIPHER_name(c)), name)
+				Expect(EVP_CIPHER_key_length(found)).To(Equal(EVP_CIPHER_key_length(c)), name)
+			}
+		})
+
+		It("Fails on unknown names", func() {
+			_, e := CipherByName("rot-13")
+			Expect(e).To(HaveOccurred())
+		})
+	})
+
+	Context("In the stream modes", func() {
+		var (
+			key       = []byte("a 128 bit key...")
+			iv        = []byte("and a 128 bit iv")
+			plaintext = []byte("CTR, OFB and CFB need no padding, and give out what goes in")
+		)
+
+		encrypt := func(c EVP_CIPHER) []byte {
+			var buf bytes.Buffer
+			w, e := NewEncryptWriter(&buf, c, key, iv)
+			Expect(e).To(BeNil())
+			_, e = io.Copy(w, bytes.NewReader(plaintext))
+			Expect(e).To(BeNil())
+			Expect(w.Close()).To(Succeed())
+			return buf.Bytes()
+		}
+
+		std := func(s cipher.Stream) []byte {
+			out := make([]byte, len(plaintext))
+			s.XORKeyStream(out, plaintext)
+			return out
+		}
+
+		var block cipher.Block
+
+		BeforeEach(func() {
+			var e error
+			block, e = aes.NewCipher(key)
+			Expect(e).To(BeNil())
+		})
+
+		It("Interoperates in CTR mode", func() {
+			Expect(encrypt(EVP_aes_128_ctr())).To(Equal(std(cipher.NewCTR(block, iv))))
+		})
+
+		It("Interoperates in OFB mode", func() {
+			Expect(encrypt(EVP_aes_128_ofb())).To(Equal(std(cipher.NewOFB(block, iv))))
+		})
+
+		It("Interoperates in CFB mode", func() {
+			Expect(encrypt(EVP_aes_128_cfb128())).To(Equal(std(cipher.NewCFBEncrypter(block, iv))))
+		})
+	})
+
+	It("Streams ChaCha20-Poly1305", func() {
+		key := bytes.Repeat([]byte{7}, 32)
+		iv := []byte("twelve bytes")
+
+		var buf bytes.Buffer
+		w, e := NewEncryptWriter(&buf, EVP_chacha20_poly1305(), key, iv)
+		Expect(e).To(BeNil())
+		_, e = w.Write([]byte("hello"))
+		Expect(e).To(BeNil())
+		Expect(w.Close()).To(Succeed())
+		Expect(buf.Len()).To(Equal(len("hello") + 16))
+
+		r, e := NewDecryptReader(&buf, EVP_chacha20_poly1305(), key, iv)
+		Expect(e).To(BeNil())
+		out, e := ioutil.ReadAll(r)
+		Expect(e).To(BeNil())
+		Expect(string(out)).To(Equal("hello"))
+	})
+})
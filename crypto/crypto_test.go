@@ -85,7 +85,7 @@ var _ = Describe("Crypto", func() {
 
 		It("should encrypt successfully", func() {
 			Expect(EVP_EncryptInit_ex(ctxEncrypt, EVP_aes_256_cbc(), SwigcptrStruct_SS_engine_st(0), "somekey", "someiv")).To(Equal(1))
-			bufEncrypt = make([]byte, len(plaintext)+ctxEncrypt.GetCipher().GetBlock_size())
+			bufEncrypt = make([]byte, len(plaintext)+EVP_CIPHER_CTX_block_size(ctxEncrypt))
 			Expect(EVP_EncryptUpdate(ctxEncrypt, bufEncrypt, &sLen, plaintext, len(plaintext))).To(Equal(1))
 			encrypted = string(bufEncrypt[:sLen])
 			Expect(EVP_EncryptFinal_ex(ctxEncrypt, bufEncrypt, &eLen)).To(Equal(1))
@@ -109,7 +109,7 @@ var _ = Describe("Crypto", func() {
 
 			Expect(EVP_EncryptInit_ex(ctxEncrypt, EVP_aes_256_cbc(), SwigcptrStruct_SS_engine_st(0), "somekey", "someiv")).To(Equal(1))
 
-			bufEncrypt = make([]byte, len(plaintext)+ctxEncrypt.GetCipher().GetBlock_size())
+			bufEncrypt = make([]byte, len(plaintext)+EVP_CIPHER_CTX_block_size(ctxEncrypt))
 
 			Expect(EVP_EncryptUpdate(ctxEncrypt, bufEncrypt, &sLen, plaintext, len(plaintext))).To(Equal(1))
 			encrypted = string(bufEncrypt[:sLen])
@@ -185,7 +185,7 @@ var _ = Describe("Crypto", func() {
 			/*
 			 * Encrypt
 			 */
-			bufEncrypt = make([]byte, len(plaintext)+ctxEncrypt.GetCipher().GetBlock_size())
+			bufEncrypt = make([]byte, len(plaintext)+EVP_CIPHER_CTX_block_size(ctxEncrypt))
 			Expect(EVP_EncryptUpdate(ctxEncrypt, bufEncrypt, &sLen, plaintext, len(plaintext))).To(Equal(1))
 			encrypted += string(bufEncrypt[:sLen])
 			Expect(EVP_EncryptFinal_ex(ctxEncrypt, bufEncrypt, &eLen)).To(Equal(1))
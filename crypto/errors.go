@@ -0,0 +1,106 @@
+package crypto
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// ErrorEntry is one entry of OpenSSL's error queue.
+type ErrorEntry struct {
+	Code     uint64
+	Library  string
+	Function string
+	Reason   string
+	File     string
+	Line     int
+}
+
+// String formats the entry as ERR_error_string_n does, followed by the place
+// in the OpenSSL sources which raised it.
+func (e ErrorEntry) String() string {
+	buf := make([]byte, 256)
+	ERR_error_string_n(e.Code, buf, int64(len(buf)))
+
+	s := cString(buf)
+	if e.File != "" {
+		s += fmt.Sprintf(" (%s:%d)", e.File, e.Line)
+	}
+	return s
+}
+
+// OpenSSLError is returned when a call into OpenSSL fails.  Entries holds
+// what OpenSSL left in its error queue, earliest first.
+type OpenSSLError struct {
+	Message string
+	Entries []ErrorEntry
+}
+
+func (e *OpenSSLError) Error() string {
+	if len(e.Entries) == 0 {
+		return e.Message
+	}
+
+	s := make([]string, len(e.Entries))
+	for i, entry := range e.Entries {
+		s[i] = entry.String()
+	}
+	return e.Message + ": " + strings.Join(s, "; ")
+}
+
+// NewOpenSSLError returns an OpenSSLError described by msg, draining the
+// error queue into it.
+//
+// OpenSSL keeps one error queue per thread, while Go moves goroutines between
+// threads.  Make the failing call and NewOpenSSLError from within
+// WithErrorQueue so that they share a queue.
+func NewOpenSSLError(msg string) *OpenSSLError {
+	return &OpenSSLError{
+		Message: msg,
+		Entries: GetErrors(),
+	}
+}
+
+// GetErrors drains the error queue of the current thread, earliest entry
+// first.
+func GetErrors() []ErrorEntry {
+	var entries []ErrorEntry
+
+	file := make([]byte, 256)
+	for {
+		var line int
+		code := ERR_get_error_file_line(file, len(file), &line)
+		if code == 0 {
+			return entries
+		}
+
+		entries = append(entries, ErrorEntry{
+			Code:     code,
+			Library:  ERR_lib_name(code),
+			Function: ERR_func_name(code),
+			Reason:   ERR_reason_name(code),
+			File:     cString(file),
+			Line:     line,
+		})
+	}
+}
+
+// WithErrorQueue runs f with the calling goroutine locked to its thread, and
+// that thread's error queue cleared, so that NewOpenSSLError called in f sees
+// the errors raised by the OpenSSL calls made in f, and only those.
+func WithErrorQueue(f func() error) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	ERR_clear_error()
+	return f()
+}
+
+// cString returns the NUL-terminated string at the start of b.
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
@@ -0,0 +1,80 @@
+package crypto_test
+
+import (
+	. "github.com/IBM-Bluemix/golang-openssl-wrapper/crypto"
+
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Errors", func() {
+	var ctx EVP_CIPHER_CTX
+
+	BeforeEach(func() {
+		ERR_load_crypto_strings()
+		OpenSSL_add_all_algorithms()
+
+		ctx = EVP_CIPHER_CTX_new()
+		EVP_CIPHER_CTX_init(ctx)
+		Expect(EVP_DecryptInit_ex(ctx, EVP_aes_256_cbc(), SwigcptrStruct_SS_engine_st(0), "thisisa256bitkeywhichhas32chars", "andwevea128bitiv")).To(Equal(1))
+	})
+
+	AfterEach(func() {
+		EVP_CIPHER_CTX_cleanup(ctx)
+	})
+
+	/* decryptTruncated fails the way a truncated CBC ciphertext does */
+	decryptTruncated := func() error {
+		var outl int
+		buf := make([]byte, 32)
+		Expect(EVP_DecryptUpdate(ctx, buf, &outl, "short", 5)).To(Equal(1))
+		if EVP_DecryptFinal_ex(ctx, buf, &outl) != 1 {
+			return NewOpenSSLError("Decryption failed")
+		}
+		return nil
+	}
+
+	It("Drains the error queue into an OpenSSLError", func() {
+		err := WithErrorQueue(decryptTruncated)
+		Expect(err).To(BeAssignableToTypeOf(&OpenSSLError{}))
+
+		oe := err.(*OpenSSLError)
+		Expect(oe.Message).To(Equal("Decryption failed"))
+		Expect(oe.Entries).NotTo(BeEmpty())
+		Expect(oe.Entries[0].Code).NotTo(BeZero())
+		Expect(oe.Entries[0].Library).To(ContainSubstring("envelope"))
+		Expect(oe.Entries[0].Reason).To(Equal("wrong final block length"))
+		Expect(oe.Entries[0].File).NotTo(BeEmpty())
+		Expect(oe.Entries[0].Line).To(BeNumerically(">", 0))
+		Expect(oe.Error()).To(ContainSubstring("Decryption failed: error:"))
+		Expect(oe.Error()).To(ContainSubstring("wrong final block length"))
+	})
+
+	It("Leaves the queue empty once drained", func() {
+		WithErrorQueue(func() error {
+			decryptTruncated()
+			Expect(ERR_peek_last_error()).NotTo(BeZero())
+			Expect(GetErrors()).NotTo(BeEmpty())
+			Expect(ERR_peek_last_error()).To(BeZero())
+			Expect(GetErrors()).To(BeEmpty())
+			return nil
+		})
+	})
+
+	It("Formats entries as ERR_error_string_n does", func() {
+		WithErrorQueue(func() error {
+			decryptTruncated()
+			code := ERR_peek_error()
+
+			buf := make([]byte, 256)
+			ERR_error_string_n(code, buf, int64(len(buf)))
+
+			entries := GetErrors()
+			Expect(entries).NotTo(BeEmpty())
+			Expect(entries[0].String()).To(HavePrefix(strings.TrimRight(string(buf), "\x00")))
+			return nil
+		})
+	})
+})
@@ -0,0 +1,78 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+)
+
+const (
+	gcmNonceSize = 12
+	gcmTagSize   = 16
+)
+
+// gcm is a cipher.AEAD which runs AES-GCM in OpenSSL.  Every call sets up a
+// context of its own, so one gcm may be used from several goroutines.
+type gcm struct {
+	cipher EVP_CIPHER
+	key    []byte
+}
+
+// NewGCM returns a cipher.AEAD which seals and opens with AES in Galois
+// Counter Mode in OpenSSL, for use wherever one from
+// crypto/cipher.NewGCM(aes.NewCipher(key)) would be.  The key is 16, 24 or
+// 32 bytes long, for AES-128, AES-192 or AES-256.  Nonces are 12 bytes long,
+// and tags 16.
+func NewGCM(key []byte) (cipher.AEAD, error) {
+	g := &gcm{key: append([]byte(nil), key...)}
+	switch len(key) {
+	case 16:
+		g.cipher = EVP_aes_128_gcm()
+	case 24:
+		g.cipher = EVP_aes_192_gcm()
+	case 32:
+		g.cipher = EVP_aes_256_gcm()
+	default:
+		return nil, aes.KeySizeError(len(key))
+	}
+	return g, nil
+}
+
+// NonceSize returns the size of the nonces Seal and Open take.
+func (g *gcm) NonceSize() int {
+	return gcmNonceSize
+}
+
+// Overhead returns how much longer a sealed message is than its plaintext.
+func (g *gcm) Overhead() int {
+	return gcmTagSize
+}
+
+// Seal encrypts and authenticates plaintext, authenticates additionalData,
+// and appends the result, ciphertext followed by tag, to dst.
+func (g *gcm) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != gcmNonceSize {
+		panic("crypto: incorrect nonce length given to GCM")
+	}
+
+	sealed, err := Seal(g.cipher, g.key, nonce, plaintext, additionalData, gcmTagSize)
+	if err != nil {
+		/* cipher.AEAD has no way to report it */
+		panic(err)
+	}
+	return append(dst, sealed...)
+}
+
+// Open authenticates and decrypts ciphertext, authenticates additionalData,
+// and appends the plaintext to dst.  If either fails to authenticate, nothing
+// is appended and ErrAuthFailed returned.
+func (g *gcm) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != gcmNonceSize {
+		panic("crypto: incorrect nonce length given to GCM")
+	}
+
+	opened, err := Open(g.cipher, g.key, nonce, ciphertext, additionalData, gcmTagSize)
+	if err != nil {
+		return nil, err
+	}
+	return append(dst, opened...), nil
+}
@@ -0,0 +1,108 @@
+package crypto_test
+
+import (
+	. "github.com/IBM-Bluemix/golang-openssl-wrapper/crypto"
+
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GCM", func() {
+	var (
+		key, nonce, plaintext, aad []byte
+		ours, std                  cipher.AEAD
+	)
+
+	BeforeEach(func() {
+		key = []byte("thisisa256bitkeywhichhas32chars.")
+		nonce = []byte("twelve bytes")
+		plaintext = []byte("My super super super super duper long string to be encrypted")
+		aad = []byte("header")
+
+		var e error
+		ours, e = NewGCM(key)
+		Expect(e).To(BeNil())
+
+		block, e := aes.NewCipher(key)
+		Expect(e).To(BeNil())
+		std, e = cipher.NewGCM(block)
+		Expect(e).To(BeNil())
+	})
+
+	It("Has the sizes of crypto/cipher's GCM", func() {
+		Expect(ours.NonceSize()).To(Equal(std.NonceSize()))
+		Expect(ours.Overhead()).To(Equal(std.Overhead()))
+	})
+
+	It("Seals as crypto/cipher does", func() {
+		Expect(ours.Seal(nil, nonce, plaintext, aad)).To(Equal(std.Seal(nil, nonce, plaintext, aad)))
+		Expect(ours.Seal(nil, nonce, nil, nil)).To(Equal(std.Seal(nil, nonce, nil, nil)))
+	})
+
+	It("Appends to dst", func() {
+		sealed := ours.Seal([]byte("prefix"), nonce, plaintext, aad)
+		Expect(sealed).To(HavePrefix("prefix"))
+		Expect(sealed).To(HaveLen(len("prefix") + len(plaintext) + ours.Overhead()))
+	})
+
+	It("Opens what crypto/cipher sealed", func() {
+		opened, e := ours.Open(nil, nonce, std.Seal(nil, nonce, plaintext, aad), aad)
+		Expect(e).To(BeNil())
+		Expect(opened).To(Equal(plaintext))
+	})
+
+	It("Works with every AES key size", func() {
+		for _, size := range []int{16, 24, 32} {
+			k := bytes.Repeat([]byte{1}, size)
+			g, e := NewGCM(k)
+			Expect(e).To(BeNil())
+
+			opened, e := g.Open(nil, nonce, g.Seal(nil, nonce, plaintext, aad), aad)
+			Expect(e).To(BeNil())
+			Expect(opened).To(Equal(plaintext))
+		}
+	})
+
+	Context("When the message was tampered with", func() {
+		var sealed []byte
+
+		BeforeEach(func() {
+			sealed = ours.Seal(nil, nonce, plaintext, aad)
+		})
+
+		It("Refuses a changed ciphertext", func() {
+			sealed[0] ^= 1
+			_, e := ours.Open(nil, nonce, sealed, aad)
+			Expect(e).To(Equal(ErrAuthFailed))
+		})
+
+		It("Refuses a changed tag", func() {
+			sealed[len(sealed)-1] ^= 1
+			_, e := ours.Open(nil, nonce, sealed, aad)
+			Expect(e).To(Equal(ErrAuthFailed))
+		})
+
+		It("Refuses other additional data", func() {
+			_, e := ours.Open(nil, nonce, sealed, []byte("other"))
+			Expect(e).To(Equal(ErrAuthFailed))
+		})
+
+		It("Refuses a message shorter than a tag", func() {
+			_, e := ours.Open(nil, nonce, sealed[:8], aad)
+			Expect(e).To(Equal(ErrAuthFailed))
+		})
+	})
+
+	It("Refuses keys of other sizes", func() {
+		_, e := NewGCM([]byte("short"))
+		Expect(e).To(Equal(aes.KeySizeError(5)))
+	})
+
+	It("Panics on nonces of other sizes", func() {
+		Expect(func() { ours.Seal(nil, []byte("short"), plaintext, nil) }).To(Panic())
+	})
+})
@@ -0,0 +1,268 @@
+package crypto
+
+import (
+	"errors"
+	"io"
+	"runtime"
+)
+
+// streamChunk bounds how much a stream hands OpenSSL at once, and so the
+// memory it needs whatever the length of the stream.
+const streamChunk = 32 * 1024
+
+// streamTagSize is the length of the tag which ends a stream sealed with an
+// AEAD cipher.
+const streamTagSize = 16
+
+var errStreamClosed = errors.New("Stream is closed")
+
+// newStreamCtx checks that c can be streamed, and returns a context set up
+// with it, and the length of the tag ending the stream, or 0 if c is not an
+// AEAD cipher.
+func newStreamCtx(c EVP_CIPHER, key, iv []byte, enc int) (EVP_CIPHER_CTX, int, error) {
+	var (
+		ctx     EVP_CIPHER_CTX
+		tagSize int
+	)
+
+	err := WithErrorQueue(func() error {
+		if c == nil || c.Swigcptr() == 0 {
+			return errors.New("Cipher is not available")
+		}
+
+		switch EVP_CIPHER_mode(c) {
+		case EVP_CIPH_CCM_MODE, EVP_CIPH_XTS_MODE, EVP_CIPH_WRAP_MODE:
+			/* These take the whole message in one call */
+			return errors.New("Cipher cannot be streamed")
+		}
+		if n := EVP_CIPHER_iv_length(c); len(iv) != n {
+			return errors.New("IV is the wrong length for the cipher")
+		}
+		if EVP_CIPHER_flags(c)&EVP_CIPH_FLAG_AEAD_CIPHER != 0 {
+			tagSize = streamTagSize
+		}
+
+		var err error
+		ctx, err = newCipherCtx(c, key, iv, enc)
+		return err
+	})
+	return ctx, tagSize, err
+}
+
+// encryptWriter encrypts what is written to it onto w.
+type encryptWriter struct {
+	w       io.Writer
+	ctx     EVP_CIPHER_CTX
+	tagSize int
+	err     error
+}
+
+// NewEncryptWriter returns a writer which encrypts with c, key and iv what is
+// written to it, and writes the ciphertext to w as it goes.  Block ciphers
+// hold back up to a block until Close pads it out.  With an AEAD cipher, such
+// as AES-GCM, Close writes the 16 byte tag after the ciphertext.
+//
+// Close must be called to finish the ciphertext.  It does not close w.
+func NewEncryptWriter(w io.Writer, c EVP_CIPHER, key, iv []byte) (io.WriteCloser, error) {
+	ctx, tagSize, err := newStreamCtx(c, key, iv, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &encryptWriter{w: w, ctx: ctx, tagSize: tagSize}
+	runtime.SetFinalizer(s, (*encryptWriter).free)
+	return s, nil
+}
+
+// Write encrypts p and writes out the ciphertext it makes.
+func (s *encryptWriter) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	n := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > streamChunk {
+			chunk = chunk[:streamChunk]
+		}
+
+		var out []byte
+		err := WithErrorQueue(func() (err error) {
+			out, err = cipherUpdate(s.ctx, chunk)
+			return err
+		})
+		if err == nil {
+			_, err = s.w.Write(out)
+		}
+		if err != nil {
+			s.fail(err)
+			return n, err
+		}
+
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// Close writes out the end of the ciphertext, padding and all, followed by
+// the tag if the cipher makes one.
+func (s *encryptWriter) Close() error {
+	if s.err != nil {
+		if s.err == errStreamClosed {
+			return nil
+		}
+		return s.err
+	}
+
+	var out []byte
+	err := WithErrorQueue(func() (err error) {
+		if out, err = cipherFinal(s.ctx); err != nil {
+			return err
+		}
+		if s.tagSize > 0 {
+			tag := make([]byte, s.tagSize)
+			if GET_TAG_GCM(s.ctx, EVP_CTRL_AEAD_GET_TAG, len(tag), tag) != 1 {
+				return NewOpenSSLError("Unable to get the tag")
+			}
+			out = append(out, tag...)
+		}
+		return nil
+	})
+	if err == nil {
+		_, err = s.w.Write(out)
+	}
+	if err != nil {
+		s.fail(err)
+		return err
+	}
+
+	s.fail(errStreamClosed)
+	return nil
+}
+
+// fail stops s, which returns err from then on.
+func (s *encryptWriter) fail(err error) {
+	s.err = err
+	s.free()
+}
+
+func (s *encryptWriter) free() {
+	if s.ctx != nil {
+		EVP_CIPHER_CTX_free(s.ctx)
+		s.ctx = nil
+	}
+}
+
+// decryptReader decrypts what it reads from r.
+type decryptReader struct {
+	r       io.Reader
+	ctx     EVP_CIPHER_CTX
+	tagSize int
+	buf     []byte
+
+	/* Read from r and not yet decrypted; this is where the tag is held back */
+	in []byte
+
+	/* Decrypted and not yet returned, and what to return after it */
+	out []byte
+	err error
+}
+
+// NewDecryptReader returns a reader which decrypts with c, key and iv the
+// ciphertext it reads from r, as written by NewEncryptWriter.  Padding is
+// checked and removed at the end of r.  With an AEAD cipher, the last 16
+// bytes of r are the tag, and the reader returns io.EOF only if it matches,
+// or ErrAuthFailed if not; until then, what it returns has not been
+// authenticated.
+func NewDecryptReader(r io.Reader, c EVP_CIPHER, key, iv []byte) (io.Reader, error) {
+	ctx, tagSize, err := newStreamCtx(c, key, iv, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &decryptReader{r: r, ctx: ctx, tagSize: tagSize, buf: make([]byte, streamChunk)}
+	runtime.SetFinalizer(s, (*decryptReader).free)
+	return s, nil
+}
+
+// Read returns plaintext as it is decrypted.
+func (s *decryptReader) Read(p []byte) (int, error) {
+	for len(s.out) == 0 && s.err == nil {
+		s.fill()
+	}
+
+	if len(s.out) > 0 {
+		n := copy(p, s.out)
+		s.out = s.out[n:]
+		return n, nil
+	}
+	return 0, s.err
+}
+
+// fill reads more ciphertext from r, and decrypts what of it can be.
+func (s *decryptReader) fill() {
+	n, rerr := s.r.Read(s.buf)
+	s.in = append(s.in, s.buf[:n]...)
+
+	if ready := len(s.in) - s.tagSize; ready > 0 {
+		err := WithErrorQueue(func() (err error) {
+			s.out, err = cipherUpdate(s.ctx, s.in[:ready])
+			return err
+		})
+		if err != nil {
+			s.fail(err)
+			return
+		}
+		s.in = append(s.in[:0], s.in[ready:]...)
+	}
+
+	switch {
+	case rerr == io.EOF:
+		s.finish()
+	case rerr != nil:
+		s.fail(rerr)
+	}
+}
+
+// finish checks the padding, or the tag, at the end of the ciphertext.
+func (s *decryptReader) finish() {
+	err := WithErrorQueue(func() error {
+		if s.tagSize > 0 {
+			if len(s.in) != s.tagSize {
+				return ErrAuthFailed
+			}
+			if SET_TAG_GCM(s.ctx, EVP_CTRL_AEAD_SET_TAG, len(s.in), string(s.in)) != 1 {
+				return NewOpenSSLError("Unable to set the tag")
+			}
+		}
+
+		out, err := cipherFinal(s.ctx)
+		if err != nil {
+			if s.tagSize > 0 {
+				return ErrAuthFailed
+			}
+			return err
+		}
+		s.out = append(s.out, out...)
+		return nil
+	})
+	if err == nil {
+		err = io.EOF
+	}
+	s.fail(err)
+}
+
+// fail stops s, which returns err once what it has decrypted is read.
+func (s *decryptReader) fail(err error) {
+	s.err = err
+	s.free()
+}
+
+func (s *decryptReader) free() {
+	if s.ctx != nil {
+		EVP_CIPHER_CTX_free(s.ctx)
+		s.ctx = nil
+	}
+}
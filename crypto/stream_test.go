@@ -0,0 +1,142 @@
+package crypto_test
+
+import (
+	. "github.com/IBM-Bluemix/golang-openssl-wrapper/crypto"
+
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"io"
+	"io/ioutil"
+	"testing/iotest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Streams", func() {
+	var (
+		key, iv, plaintext []byte
+	)
+
+	BeforeEach(func() {
+		key = []byte("thisisa256bitkeywhichhas32chars.")
+		plaintext = bytes.Repeat([]byte("My super super super super duper long string to be encrypted"), 20000)
+	})
+
+	encrypt := func(c EVP_CIPHER, plaintext []byte) []byte {
+		var buf bytes.Buffer
+		w, e := NewEncryptWriter(&buf, c, key, iv)
+		Expect(e).To(BeNil())
+
+		/* Odd sized writes leave partial blocks behind */
+		_, e = io.CopyBuffer(w, bytes.NewReader(plaintext), make([]byte, 1000))
+		Expect(e).To(BeNil())
+		Expect(w.Close()).To(Succeed())
+		return buf.Bytes()
+	}
+
+	decrypt := func(c EVP_CIPHER, ciphertext []byte) ([]byte, error) {
+		r, e := NewDecryptReader(bytes.NewReader(ciphertext), c, key, iv)
+		Expect(e).To(BeNil())
+		return ioutil.ReadAll(r)
+	}
+
+	Context("With a block cipher", func() {
+		BeforeEach(func() {
+			iv = []byte("andwevea128bitiv")
+		})
+
+		It("Pads the ciphertext as PKCS#7 does", func() {
+			block, e := aes.NewCipher(key)
+			Expect(e).To(BeNil())
+
+			pad := aes.BlockSize - len(plaintext)%aes.BlockSize
+			padded := append(append([]byte(nil), plaintext...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+			want := make([]byte, len(padded))
+			cipher.NewCBCEncrypter(block, iv).CryptBlocks(want, padded)
+
+			Expect(encrypt(EVP_aes_256_cbc(), plaintext)).To(Equal(want))
+		})
+
+		It("Decrypts what it encrypted", func() {
+			decrypted, e := decrypt(EVP_aes_256_cbc(), encrypt(EVP_aes_256_cbc(), plaintext))
+			Expect(e).To(BeNil())
+			Expect(decrypted).To(Equal(plaintext))
+		})
+
+		It("Decrypts a byte at a time", func() {
+			ciphertext := encrypt(EVP_aes_256_cbc(), []byte("short"))
+			r, e := NewDecryptReader(iotest.OneByteReader(bytes.NewReader(ciphertext)), EVP_aes_256_cbc(), key, iv)
+			Expect(e).To(BeNil())
+
+			decrypted, e := ioutil.ReadAll(iotest.OneByteReader(r))
+			Expect(e).To(BeNil())
+			Expect(decrypted).To(Equal([]byte("short")))
+		})
+
+		It("Encrypts an empty stream to a block of padding", func() {
+			Expect(encrypt(EVP_aes_256_cbc(), nil)).To(HaveLen(aes.BlockSize))
+		})
+
+		It("Fails on a truncated ciphertext", func() {
+			ciphertext := encrypt(EVP_aes_256_cbc(), plaintext)
+			_, e := decrypt(EVP_aes_256_cbc(), ciphertext[:len(ciphertext)-1])
+			Expect(e).To(HaveOccurred())
+		})
+	})
+
+	Context("With an AEAD cipher", func() {
+		BeforeEach(func() {
+			iv = []byte("twelve bytes")
+		})
+
+		It("Writes the ciphertext and tag as Seal does", func() {
+			g, e := NewGCM(key)
+			Expect(e).To(BeNil())
+			Expect(encrypt(EVP_aes_256_gcm(), plaintext)).To(Equal(g.Seal(nil, iv, plaintext, nil)))
+		})
+
+		It("Decrypts and authenticates what it encrypted", func() {
+			decrypted, e := decrypt(EVP_aes_256_gcm(), encrypt(EVP_aes_256_gcm(), plaintext))
+			Expect(e).To(BeNil())
+			Expect(decrypted).To(Equal(plaintext))
+		})
+
+		It("Fails at the end of a tampered ciphertext", func() {
+			ciphertext := encrypt(EVP_aes_256_gcm(), plaintext)
+			ciphertext[0] ^= 1
+
+			decrypted, e := decrypt(EVP_aes_256_gcm(), ciphertext)
+			Expect(e).To(Equal(ErrAuthFailed))
+			Expect(len(decrypted)).To(BeNumerically("<=", len(plaintext)))
+		})
+
+		It("Fails without a whole tag", func() {
+			_, e := decrypt(EVP_aes_256_gcm(), []byte("short"))
+			Expect(e).To(Equal(ErrAuthFailed))
+		})
+	})
+
+	It("Refuses an IV of the wrong length", func() {
+		_, e := NewEncryptWriter(ioutil.Discard, EVP_aes_256_cbc(), key, []byte("short"))
+		Expect(e).To(HaveOccurred())
+		_, e = NewDecryptReader(bytes.NewReader(nil), EVP_aes_256_cbc(), key, nil)
+		Expect(e).To(HaveOccurred())
+	})
+
+	It("Refuses a key of the wrong length", func() {
+		_, e := NewEncryptWriter(ioutil.Discard, EVP_aes_256_cbc(), []byte("short"), []byte("andwevea128bitiv"))
+		Expect(e).To(HaveOccurred())
+	})
+
+	It("Refuses writes after Close", func() {
+		w, e := NewEncryptWriter(ioutil.Discard, EVP_aes_256_cbc(), key, []byte("andwevea128bitiv"))
+		Expect(e).To(BeNil())
+		Expect(w.Close()).To(Succeed())
+		Expect(w.Close()).To(Succeed())
+
+		_, e = w.Write([]byte("late"))
+		Expect(e).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,15 @@
+package crypto
+
+// Version returns the version string of the OpenSSL library in use, such as
+// "OpenSSL 1.1.1w  11 Sep 2023".
+func Version() string {
+	return OpenSSL_version(OPENSSL_VERSION)
+}
+
+// VersionNumber returns the version of the OpenSSL library in use, encoded as
+// OPENSSL_VERSION_NUMBER is: 0x1010117f is 1.1.1w, and 0x30000020 is 3.0.2.
+// OPENSSL_VERSION_NUMBER itself is the version of the headers the wrappers
+// were built against; a shared library may be newer.
+func VersionNumber() uint64 {
+	return OpenSSL_version_num()
+}
@@ -0,0 +1,29 @@
+package crypto_test
+
+import (
+	. "github.com/IBM-Bluemix/golang-openssl-wrapper/crypto"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Version", func() {
+	It("Names the library in use", func() {
+		Expect(Version()).To(HavePrefix("OpenSSL "))
+	})
+
+	It("Is a supported release", func() {
+		Expect(VersionNumber()).To(BeNumerically(">=", 0x10002000))
+	})
+
+	It("Shares a major release with the headers", func() {
+		/* 1.x numbers by major and minor, 3.x by major alone */
+		major := func(v uint64) uint64 {
+			if v>>28 >= 3 {
+				return v >> 28
+			}
+			return v >> 20
+		}
+		Expect(major(VersionNumber())).To(Equal(major(OPENSSL_VERSION_NUMBER)))
+	})
+})
@@ -1,7 +1,7 @@
 package digest_test
 
 import (
-	. "github.com/IBM-Bluemix/golang-openssl-wrapper/digest"
+	"github.com/IBM-Bluemix/golang-openssl-wrapper/digest"
 
 	"bytes"
 	"github.com/IBM-Bluemix/golang-openssl-wrapper/rand"
@@ -18,7 +18,7 @@ var _ = Describe("Hash", func() {
 			err        error
 			data, key1 []byte
 			seqlen     int
-			hasher1    *Digest
+			hasher1    *digest.Digest
 		)
 
 		BeforeEach(func() {
@@ -26,7 +26,7 @@ var _ = Describe("Hash", func() {
 			data = make([]byte, seqlen)
 			Expect(rand.RAND_bytes(data, seqlen)).To(Equal(1))
 
-			hasher1 = NewSHA256()
+			hasher1 = digest.NewSHA256()
 			Expect(hasher1).NotTo(BeNil())
 			ret, err = hasher1.Write(data)
 			Expect(ret).To(Equal(len(data)))
@@ -37,19 +37,19 @@ var _ = Describe("Hash", func() {
 		})
 
 		It("Returns the correct digest length", func() {
-			s := EVP_MD_size(EVP_sha256())
+			s := digest.EVP_MD_size(digest.EVP_sha256())
 			Expect(s).To(BeNumerically(">", 0))
 			Expect(hasher1.Size()).To(Equal(s))
 		})
 
 		It("Returns the correct block size", func() {
-			s := EVP_MD_block_size(EVP_sha256())
+			s := digest.EVP_MD_block_size(digest.EVP_sha256())
 			Expect(s).To(BeNumerically(">", 0))
 			Expect(hasher1.BlockSize()).To(Equal(s))
 		})
 
 		It("Produces identical hash values from the same binary data", func() {
-			hasher2 := NewSHA256()
+			hasher2 := digest.NewSHA256()
 			Expect(hasher2).NotTo(BeNil())
 			ret, err = hasher2.Write(data)
 			Expect(ret).To(Equal(len(data)))
@@ -65,7 +65,7 @@ var _ = Describe("Hash", func() {
 			data2 := make([]byte, seqlen)
 			Expect(rand.RAND_bytes(data2, seqlen)).To(Equal(1))
 
-			hasher2 := NewSHA256()
+			hasher2 := digest.NewSHA256()
 			Expect(hasher2).NotTo(BeNil())
 			ret, err = hasher2.Write(data2)
 			Expect(ret).To(Equal(len(data2)))
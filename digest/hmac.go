@@ -0,0 +1,110 @@
+package digest
+
+import (
+	"crypto/subtle"
+	"errors"
+	"runtime"
+)
+
+// HMAC represents a keyed-hash message authentication code.
+// It implements the hash.Hash interface.
+type HMAC struct {
+	md      EVP_MD
+	key     EVP_PKEY
+	context EVP_MD_CTX
+}
+
+// NewHMAC returns a pointer to an HMAC which authenticates with key and md,
+// one of the digests of this package, such as EVP_sha256().  It returns nil
+// if OpenSSL cannot run HMAC with md, as in FIPS mode with EVP_md5().
+func NewHMAC(md EVP_MD, key []byte) *HMAC {
+	if md == nil || md.Swigcptr() == 0 {
+		return nil
+	}
+
+	pkey := EVP_PKEY_new_hmac_key(string(key), len(key))
+	if pkey == nil || pkey.Swigcptr() == 0 {
+		return nil
+	}
+
+	h := &HMAC{md: md, key: pkey}
+	runtime.SetFinalizer(h, (*HMAC).free)
+	if !h.init() {
+		return nil
+	}
+	return h
+}
+
+// init gives h a new context, ready for a new message.
+func (h *HMAC) init() bool {
+	if h.context != nil {
+		Free_EVP_MD_CTX(h.context)
+	}
+
+	h.context = Malloc_EVP_MD_CTX()
+	if h.context == nil || h.context.Swigcptr() == 0 {
+		h.context = nil
+		return false
+	}
+	return EVP_DigestSignInit_hmac(h.context, h.md, h.key) == 1
+}
+
+// Write adds the contents of p to the message being authenticated.
+// Write returns the number of bytes written and an error, if OpenSSL fails.
+func (h *HMAC) Write(p []byte) (int, error) {
+	if EVP_DigestSignUpdate_hmac(h.context, string(p), len(p)) != 1 {
+		return 0, errors.New("Unable to update the HMAC")
+	}
+	return len(p), nil
+}
+
+// Sum returns the HMAC of what has been written so far.
+// If p is nil, the bare HMAC is returned.
+// If p is not nil, the HMAC is appended to p, which is then returned.
+// Sum panics if OpenSSL fails, as hash.Hash has no way to report it.
+func (h *HMAC) Sum(p []byte) []byte {
+	/* OpenSSL finishes a copy of the context, so the user can still write/sum using the original */
+	buf := make([]byte, EVP_MAX_MD_SIZE)
+	n := EVP_DigestSignFinal_hmac(h.context, buf, len(buf))
+	if n == 0 {
+		panic("digest: unable to finish the HMAC")
+	}
+
+	return append(p, buf[:n]...)
+}
+
+// Reset starts a new message, with the same key.
+// Reset panics if OpenSSL fails, as hash.Hash has no way to report it.
+func (h *HMAC) Reset() {
+	if !h.init() {
+		panic("digest: unable to reset the HMAC")
+	}
+}
+
+// Size returns the length of the HMAC (what Sum() will return)
+func (h *HMAC) Size() int {
+	return EVP_MD_size(h.md)
+}
+
+// BlockSize returns the underlying block size for the HMAC.
+func (h *HMAC) BlockSize() int {
+	return EVP_MD_block_size(h.md)
+}
+
+func (h *HMAC) free() {
+	if h.context != nil {
+		Free_EVP_MD_CTX(h.context)
+		h.context = nil
+	}
+	if h.key != nil {
+		EVP_PKEY_free(h.key)
+		h.key = nil
+	}
+}
+
+// Equal compares two MACs for equality without leaking timing information,
+// as crypto/hmac.Equal does.  Compare a MAC received with the one computed
+// for its message with this, never with bytes.Equal.
+func Equal(mac1, mac2 []byte) bool {
+	return subtle.ConstantTimeCompare(mac1, mac2) == 1
+}
@@ -0,0 +1,108 @@
+package digest_test
+
+import (
+	"github.com/IBM-Bluemix/golang-openssl-wrapper/digest"
+
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HMAC", func() {
+	var (
+		key  = []byte("Jefe")
+		data = []byte("what do ya want for nothing?")
+	)
+
+	It("Matches RFC 4231", func() {
+		h := digest.NewHMAC(digest.EVP_sha256(), key)
+		Expect(h).NotTo(BeNil())
+		h.Write(data)
+		Expect(hex.EncodeToString(h.Sum(nil))).To(Equal("5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"))
+	})
+
+	It("Matches crypto/hmac for every digest", func() {
+		for name, md := range map[string]struct {
+			ours digest.EVP_MD
+			std  func() hash.Hash
+		}{
+			"SHA-1":   {digest.EVP_sha1(), sha1.New},
+			"SHA-224": {digest.EVP_sha224(), sha256.New224},
+			"SHA-256": {digest.EVP_sha256(), sha256.New},
+			"SHA-384": {digest.EVP_sha384(), sha512.New384},
+			"SHA-512": {digest.EVP_sha512(), sha512.New},
+			"MD5":     {digest.EVP_md5(), md5.New},
+		} {
+			h := digest.NewHMAC(md.ours, key)
+			Expect(h).NotTo(BeNil(), name)
+			std := hmac.New(md.std, key)
+
+			h.Write(data)
+			std.Write(data)
+			Expect(h.Sum(nil)).To(Equal(std.Sum(nil)), name)
+			Expect(h.Size()).To(Equal(std.Size()), name)
+			Expect(h.BlockSize()).To(Equal(std.BlockSize()), name)
+		}
+	})
+
+	It("Takes keys longer than a block", func() {
+		long := make([]byte, 200)
+		h := digest.NewHMAC(digest.EVP_sha256(), long)
+		h.Write(data)
+
+		std := hmac.New(sha256.New, long)
+		std.Write(data)
+		Expect(h.Sum(nil)).To(Equal(std.Sum(nil)))
+	})
+
+	It("Takes an empty key", func() {
+		h := digest.NewHMAC(digest.EVP_sha256(), nil)
+		Expect(h).NotTo(BeNil())
+
+		std := hmac.New(sha256.New, nil)
+		Expect(h.Sum(nil)).To(Equal(std.Sum(nil)))
+	})
+
+	It("Keeps taking data after Sum, and appends to its argument", func() {
+		h := digest.NewHMAC(digest.EVP_sha256(), key)
+		h.Write(data[:10])
+		first := h.Sum(nil)
+		h.Write(data[10:])
+
+		std := hmac.New(sha256.New, key)
+		std.Write(data)
+		Expect(h.Sum([]byte("prefix"))).To(Equal(std.Sum([]byte("prefix"))))
+		Expect(first).NotTo(Equal(std.Sum(nil)))
+	})
+
+	It("Starts over on Reset", func() {
+		h := digest.NewHMAC(digest.EVP_sha256(), key)
+		h.Write([]byte("something else"))
+		h.Reset()
+		h.Write(data)
+
+		std := hmac.New(sha256.New, key)
+		std.Write(data)
+		Expect(h.Sum(nil)).To(Equal(std.Sum(nil)))
+	})
+
+	It("Compares MACs", func() {
+		h := digest.NewHMAC(digest.EVP_sha256(), key)
+		h.Write(data)
+		mac := h.Sum(nil)
+
+		Expect(digest.Equal(mac, h.Sum(nil))).To(BeTrue())
+		Expect(digest.Equal(mac, mac[1:])).To(BeFalse())
+
+		other := append([]byte(nil), mac...)
+		other[0] ^= 1
+		Expect(digest.Equal(mac, other)).To(BeFalse())
+	})
+})
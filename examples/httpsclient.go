@@ -9,7 +9,7 @@ import (
 
 func main() {
 	// Create a new HTTPS client
-	client := ssl.NewHTTPSClient()
+	client := ssl.NewHTTPSClient(nil)
 
 	// Call HTTP GET on the client
 	response, err := client.Get("https://httpbin.org/ip")
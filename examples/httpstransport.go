@@ -12,7 +12,7 @@ func main() {
 	// Create a new HTTPS client
 	client := http.Client{
 		// Use our transport for FIPS compliant OpenSSL
-		Transport: ssl.NewHTTPSTransport(nil),
+		Transport: ssl.NewHTTPSTransport(nil, nil),
 	}
 
 	// Call HTTP GET on the client
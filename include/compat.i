@@ -0,0 +1,137 @@
+/*
+ * Compatibility across OpenSSL 1.0.2, 1.1.1 and 3.x.  The SWIG interfaces
+ * are written against the 1.1 API.  On 1.0.2, this fills in the parts of it
+ * the wrappers rely on; on 1.1 and later, it stands in for what those
+ * releases turned into macros or dropped.  The choice is made when the
+ * wrappers are compiled, from OPENSSL_VERSION_NUMBER.
+ *
+ * Modules include this after their own OpenSSL headers.
+ */
+%{
+#include <openssl/opensslv.h>
+#include <openssl/crypto.h>
+#include <openssl/err.h>
+#include <openssl/evp.h>
+#include <string.h>
+
+#if OPENSSL_VERSION_NUMBER < 0x10100000L
+#include <pthread.h>
+#include <openssl/buffer.h>
+
+/* Run-once and read/write locks, as 1.1 provides them */
+typedef pthread_once_t CRYPTO_ONCE;
+#define CRYPTO_ONCE_STATIC_INIT PTHREAD_ONCE_INIT
+
+static int CRYPTO_THREAD_run_once(CRYPTO_ONCE *once, void (*init)(void)) {
+    return pthread_once(once, init) == 0;
+}
+
+typedef pthread_rwlock_t CRYPTO_RWLOCK;
+
+static CRYPTO_RWLOCK *CRYPTO_THREAD_lock_new(void) {
+    CRYPTO_RWLOCK *lock = OPENSSL_malloc(sizeof(*lock));
+
+    if (lock != NULL && pthread_rwlock_init(lock, NULL) != 0) {
+        OPENSSL_free(lock);
+        return NULL;
+    }
+    return lock;
+}
+
+static int CRYPTO_THREAD_read_lock(CRYPTO_RWLOCK *lock) {
+    return pthread_rwlock_rdlock(lock) == 0;
+}
+
+static int CRYPTO_THREAD_write_lock(CRYPTO_RWLOCK *lock) {
+    return pthread_rwlock_wrlock(lock) == 0;
+}
+
+static int CRYPTO_THREAD_unlock(CRYPTO_RWLOCK *lock) {
+    return pthread_rwlock_unlock(lock) == 0;
+}
+
+static void CRYPTO_THREAD_lock_free(CRYPTO_RWLOCK *lock) {
+    if (lock != NULL) {
+        pthread_rwlock_destroy(lock);
+        OPENSSL_free(lock);
+    }
+}
+
+/* Memory helpers */
+static void *compat_zalloc(size_t num) {
+    void *p = OPENSSL_malloc(num);
+
+    if (p != NULL) {
+        memset(p, 0, num);
+    }
+    return p;
+}
+
+static void compat_clear_free(void *p, size_t num) {
+    if (p != NULL) {
+        OPENSSL_cleanse(p, num);
+        OPENSSL_free(p);
+    }
+}
+
+#define OPENSSL_zalloc(num)         compat_zalloc(num)
+#define OPENSSL_clear_free(p, num)  compat_clear_free((p), (num))
+#define OPENSSL_memdup(p, num)      BUF_memdup((p), (num))
+#define OPENSSL_strdup(s)           BUF_strdup(s)
+
+/* Digest contexts got their 1.1 names */
+#define EVP_MD_CTX_new()            EVP_MD_CTX_create()
+#define EVP_MD_CTX_free(ctx)        EVP_MD_CTX_destroy(ctx)
+
+/* OpenSSL_version takes the 1.1 constants, which SSLeay_version numbers differently */
+#define OPENSSL_VERSION             0
+#define OPENSSL_CFLAGS              1
+#define OPENSSL_BUILT_ON            2
+#define OPENSSL_PLATFORM            3
+#define OPENSSL_DIR                 4
+
+static const char *OpenSSL_version(int t) {
+    switch (t) {
+    case OPENSSL_CFLAGS:
+        return SSLeay_version(SSLEAY_CFLAGS);
+    case OPENSSL_BUILT_ON:
+        return SSLeay_version(SSLEAY_BUILT_ON);
+    case OPENSSL_PLATFORM:
+        return SSLeay_version(SSLEAY_PLATFORM);
+    case OPENSSL_DIR:
+        return SSLeay_version(SSLEAY_DIR);
+    }
+    return SSLeay_version(SSLEAY_VERSION);
+}
+
+#define OpenSSL_version_num()       SSLeay()
+
+#else
+
+/* Library cleanup is automatic since 1.1, and these became empty statements rather than calls */
+#undef EVP_cleanup
+#undef ERR_free_strings
+
+static void EVP_cleanup(void) {
+}
+
+static void ERR_free_strings(void) {
+}
+
+#ifndef EVP_MD_CTX_cleanup
+#define EVP_MD_CTX_cleanup(ctx)     EVP_MD_CTX_reset(ctx)
+#endif
+
+#endif
+
+#if OPENSSL_VERSION_NUMBER >= 0x30000000L
+/* FIPS mode is a property of the default library context since 3.0 */
+static int FIPS_mode_set(int r) {
+    return EVP_default_properties_enable_fips(NULL, r);
+}
+
+static int FIPS_mode(void) {
+    return EVP_default_properties_is_fips_enabled(NULL);
+}
+#endif
+%}
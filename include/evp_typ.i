@@ -1,8 +1,6 @@
 %{
 #include <openssl/engine.h>
-#ifndef HEADER_ENVELOPE_H
-#include <openssl.evp.h>
-#endif
+#include <openssl/evp.h>
 %}
 /*
  * From openssl/engine.h
@@ -17,14 +15,5 @@ typedef struct engine_st ENGINE;
 typedef struct env_md_st EVP_MD;
 typedef struct evp_pkey_ctx_st EVP_PKEY_CTX;
 
-typedef struct env_md_ctx_st {
-    const EVP_MD *digest;
-    ENGINE *engine;             /* functional reference if 'digest' is
-                                 * ENGINE-provided */
-    unsigned long flags;
-    void *md_data;
-    /* Public key context for sign/verify */
-    EVP_PKEY_CTX *pctx;
-    /* Update function: usually copied from EVP_MD */
-    int (*update) (EVP_MD_CTX *ctx, const void *data, size_t count);
-} EVP_MD_CTX;
\ No newline at end of file
+/* Opaque since OpenSSL 1.1; allocate with EVP_MD_CTX_create or Malloc_EVP_MD_CTX */
+typedef struct evp_md_ctx_st EVP_MD_CTX;
@@ -0,0 +1,307 @@
+package ssl
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/IBM-Bluemix/golang-openssl-wrapper/crypto"
+)
+
+// Defaults used for any Config field left at its zero value.
+const (
+	DefaultCAPath      = "/etc/ssl/certs"
+	DefaultCipherList  = "HIGH:!aNULL:!kRSA:!PSK:!SRP:!MD5:!RC4"
+	DefaultVerifyDepth = 4
+)
+
+// Config holds the TLS settings for the HTTPS transport, client and server.
+// It plays the same role as crypto/tls.Config.
+// A nil *Config, or any field left at its zero value, selects the package default.
+type Config struct {
+	// CAFile names a PEM file of trusted certificates, and CAPath a directory
+	// of hashed certificates as prepared by c_rehash.
+	// If both are empty, DefaultCAPath is used.
+	CAFile string
+	CAPath string
+
+	// CipherList is the OpenSSL cipher list used for TLS 1.2 and below.
+	CipherList string
+
+	// CipherSuites is the colon-separated TLS 1.3 ciphersuite list,
+	// e.g. "TLS_AES_256_GCM_SHA384:TLS_CHACHA20_POLY1305_SHA256".
+	// If empty, the OpenSSL defaults apply.
+	CipherSuites string
+
+	// NextProtos lists the application protocols offered through ALPN, most
+	// preferred first, e.g. []string{"h2", "http/1.1"}.  A server chooses its
+	// most preferred protocol among those the client offers, and refuses a
+	// client offering none of them.  The result is in
+	// ConnectionState.NegotiatedProtocol.
+	NextProtos []string
+
+	// MinVersion and MaxVersion bound the negotiated protocol version using the
+	// TLS1_VERSION ... TLS1_3_VERSION constants.  Zero leaves the bound to OpenSSL.
+	MinVersion int
+	MaxVersion int
+
+	// VerifyMode holds SSL_VERIFY_* flags.  Clients always verify the server
+	// (SSL_VERIFY_PEER) unless InsecureSkipVerify is set; servers only ask for a
+	// client certificate if VerifyMode includes SSL_VERIFY_PEER.
+	// A server's ClientAuth, if set, takes precedence.
+	VerifyMode int
+
+	// ClientAuth is the server's policy for client certificates.
+	ClientAuth ClientAuthType
+
+	// ClientCAFile names a PEM file of the CAs trusted to issue client
+	// certificates, and ClientCAPath a directory of them as prepared by
+	// c_rehash.  A server asking for a certificate sends clients the names of
+	// the CAs in ClientCAFile.  If both are empty, CAFile and CAPath are used.
+	ClientCAFile string
+	ClientCAPath string
+
+	// VerifyDepth is the maximum length of the peer's certificate chain.
+	VerifyDepth int
+
+	// ServerName is the host name a client sends in SNI and expects in the
+	// server's certificate.  It overrides the host of the dialed address, and
+	// Client requires it unless InsecureSkipVerify is set.
+	ServerName string
+
+	// InsecureSkipVerify turns off verification of the server's certificate
+	// chain and host name.  Connections are then open to man-in-the-middle
+	// attacks, so this should only be used for testing.
+	InsecureSkipVerify bool
+
+	// CertFile and KeyFile name the PEM certificate chain and private key
+	// presented to the peer.  A server uses them when ListenAndServeTLS is
+	// called without files; a client sends them if the server asks.
+	CertFile string
+	KeyFile  string
+
+	// Certificates maps the names a server answers to onto the key pairs it
+	// presents to clients asking for them through SNI.  A name may be a
+	// wildcard such as "*.example.com", which matches a single label; exact
+	// names take precedence.  Clients sending no SNI, or a name not found
+	// here, are presented CertFile and KeyFile.  All other settings apply
+	// whichever key pair is chosen.
+	Certificates map[string]KeyPair
+
+	// CertReloadInterval, if not zero, makes a server check the files of its
+	// key pairs this often, and reload them when they change.  See
+	// Server.ReloadCertificates.
+	CertReloadInterval time.Duration
+
+	// ClientSessionCache, if set, keeps the sessions handed out by servers so
+	// that clients can resume them.  Nil disables resumption.
+	ClientSessionCache *ClientSessionCache
+
+	// SessionCacheSize is the number of sessions a server keeps for clients
+	// resuming by session ID.  Zero leaves OpenSSL's default, and a negative
+	// value turns the cache off, leaving resumption to session tickets.
+	SessionCacheSize int
+
+	// SessionTimeout is how long a server lets a session be resumed, whether
+	// from its cache or from a ticket.  Zero leaves OpenSSL's default.
+	SessionTimeout time.Duration
+
+	// SessionTicketsDisabled stops a server handing out session tickets.
+	SessionTicketsDisabled bool
+
+	// SessionTicketKeys supplies the keys a server seals session tickets
+	// with, and TicketKeyRotation is how often a listener asks it for new
+	// ones.  Servers sharing a source, such as the replicas behind a load
+	// balancer, resume each other's sessions.  If nil, each listener makes
+	// random keys of its own and replaces them every TicketKeyRotation.
+	// Zero selects DefaultTicketKeyRotation.
+	SessionTicketKeys TicketKeySource
+	TicketKeyRotation time.Duration
+
+	// HandshakeTimeout bounds the time a client spends connecting and
+	// completing the TLS handshake.  Zero means no timeout.
+	HandshakeTimeout time.Duration
+}
+
+// KeyPair names the PEM certificate chain and private key files of a
+// certificate.
+type KeyPair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// ClientAuthType is a server's policy for TLS client authentication, as in
+// crypto/tls.
+type ClientAuthType int
+
+const (
+	// NoClientCert leaves client certificates to Config.VerifyMode, which by
+	// default does not ask for one.
+	NoClientCert ClientAuthType = iota
+
+	// RequestClientCert asks for a client certificate but does not require
+	// or verify it.
+	RequestClientCert
+
+	// RequireAnyClientCert requires a client certificate but does not verify
+	// it.
+	RequireAnyClientCert
+
+	// VerifyClientCertIfGiven asks for a client certificate and verifies it
+	// if one is sent.
+	VerifyClientCertIfGiven
+
+	// RequireAndVerifyClientCert requires a client certificate and verifies
+	// it.
+	RequireAndVerifyClientCert
+)
+
+// verifyMode returns the SSL_VERIFY_* flags for a client or server context,
+// and whether OpenSSL's verdict on the peer's certificate is acted upon.
+func (c *Config) verifyMode(client bool) (int, bool) {
+	if client {
+		if c.InsecureSkipVerify {
+			return SSL_VERIFY_NONE, true
+		}
+		return c.VerifyMode | SSL_VERIFY_PEER, true
+	}
+
+	switch c.ClientAuth {
+	case RequestClientCert:
+		return SSL_VERIFY_PEER, false
+	case RequireAnyClientCert:
+		return SSL_VERIFY_PEER | SSL_VERIFY_FAIL_IF_NO_PEER_CERT, false
+	case VerifyClientCertIfGiven:
+		return SSL_VERIFY_PEER, true
+	case RequireAndVerifyClientCert:
+		return SSL_VERIFY_PEER | SSL_VERIFY_FAIL_IF_NO_PEER_CERT, true
+	}
+	return c.VerifyMode, true
+}
+
+// apply configures ctx according to c.  OpenSSL failures are returned as a
+// *crypto.OpenSSLError, so apply must run within crypto.WithErrorQueue.
+func (c *Config) apply(ctx SSL_CTX, client bool) error {
+	if c == nil {
+		c = &Config{}
+	}
+
+	if mode, verify := c.verifyMode(client); verify {
+		SSL_CTX_set_verify(ctx, mode, nil)
+	} else {
+		SSL_CTX_set_verify_accept_all(ctx, mode)
+	}
+
+	depth := c.VerifyDepth
+	if depth == 0 {
+		depth = DefaultVerifyDepth
+	}
+	SSL_CTX_set_verify_depth(ctx, depth)
+
+	caFile, caPath := c.CAFile, c.CAPath
+	if !client && (c.ClientCAFile != "" || c.ClientCAPath != "") {
+		caFile, caPath = c.ClientCAFile, c.ClientCAPath
+	}
+	if caFile == "" && caPath == "" {
+		caPath = DefaultCAPath
+	}
+	if SSL_CTX_load_verify_locations(ctx, caFile, caPath) != 1 {
+		return crypto.NewOpenSSLError("Unable to load certificates for verification")
+	}
+
+	if !client && c.ClientCAFile != "" && SSL_CTX_load_client_CA_file(ctx, c.ClientCAFile) != 1 {
+		return crypto.NewOpenSSLError(fmt.Sprintf("Unable to load client CA names from %q", c.ClientCAFile))
+	}
+
+	ciphers := c.CipherList
+	if ciphers == "" {
+		ciphers = DefaultCipherList
+	}
+	if SSL_CTX_set_cipher_list(ctx, ciphers) != 1 {
+		return crypto.NewOpenSSLError(fmt.Sprintf("Unable to configure ciphers %q", ciphers))
+	}
+
+	if c.CipherSuites != "" && SSL_CTX_set_ciphersuites(ctx, c.CipherSuites) != 1 {
+		return crypto.NewOpenSSLError(fmt.Sprintf("Unable to configure TLS 1.3 ciphersuites %q", c.CipherSuites))
+	}
+
+	if c.MinVersion != 0 && c.MaxVersion != 0 && c.MinVersion > c.MaxVersion {
+		return errors.New("MinVersion is greater than MaxVersion")
+	}
+	if c.MinVersion != 0 && SSL_CTX_set_min_proto_version(ctx, c.MinVersion) != 1 {
+		return crypto.NewOpenSSLError(fmt.Sprintf("Unable to set minimum protocol version %#x", c.MinVersion))
+	}
+	if c.MaxVersion != 0 && SSL_CTX_set_max_proto_version(ctx, c.MaxVersion) != 1 {
+		return crypto.NewOpenSSLError(fmt.Sprintf("Unable to set maximum protocol version %#x", c.MaxVersion))
+	}
+
+	if len(c.NextProtos) > 0 {
+		if err := setNextProtos(ctx, c.NextProtos, client); err != nil {
+			return err
+		}
+	}
+
+	if client && c.ClientSessionCache != nil && SSL_CTX_enable_client_sessions(ctx) != 1 {
+		return crypto.NewOpenSSLError("Unable to enable client sessions")
+	}
+
+	if !client {
+		/* Round up, so that a timeout under a second is not taken as the default */
+		timeout := int64((c.SessionTimeout + time.Second - 1) / time.Second)
+		tickets := 1
+		if c.SessionTicketsDisabled {
+			tickets = 0
+		}
+		if SSL_CTX_set_server_sessions(ctx, int64(c.SessionCacheSize), timeout, tickets) != 1 {
+			return crypto.NewOpenSSLError("Unable to configure server sessions")
+		}
+	}
+
+	/* Servers load their key pair in ListenAndServeTLS */
+	if client && (c.CertFile != "" || c.KeyFile != "") {
+		return useKeyPair(ctx, c.CertFile, c.KeyFile)
+	}
+
+	return nil
+}
+
+// useKeyPair loads the PEM certificate chain cf and private key kf into ctx.
+// Like apply, it must run within crypto.WithErrorQueue.
+func useKeyPair(ctx SSL_CTX, cf, kf string) error {
+	if SSL_CTX_use_certificate_chain_file(ctx, cf) <= 0 {
+		return crypto.NewOpenSSLError("Could not use certificate file")
+	}
+
+	if SSL_CTX_use_PrivateKey_file(ctx, kf, SSL_FILETYPE_PEM) <= 0 {
+		return crypto.NewOpenSSLError("Could not use key file")
+	}
+
+	if SSL_CTX_check_private_key(ctx) < 1 {
+		return crypto.NewOpenSSLError("Private key does not match the public certificate")
+	}
+
+	return nil
+}
+
+// setNextProtos configures ALPN on ctx.  Like apply, it must run within
+// crypto.WithErrorQueue.
+func setNextProtos(ctx SSL_CTX, protos []string, client bool) error {
+	/* Each protocol is sent as a length byte followed by the name */
+	var wire []byte
+	for _, p := range protos {
+		if len(p) == 0 || len(p) > 255 {
+			return fmt.Errorf("Invalid ALPN protocol %q", p)
+		}
+		wire = append(wire, byte(len(p)))
+		wire = append(wire, p...)
+	}
+
+	set := SSL_CTX_set_alpn_server_protos
+	if client {
+		set = SSL_CTX_set_alpn_client_protos
+	}
+	if set(ctx, string(wire), len(wire)) != 1 {
+		return crypto.NewOpenSSLError("Unable to configure ALPN")
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package ssl_test
+
+import (
+	. "github.com/IBM-Bluemix/golang-openssl-wrapper/ssl"
+
+	"net"
+
+	"github.com/IBM-Bluemix/golang-openssl-wrapper/crypto"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	var cfg *Config
+
+	BeforeEach(func() {
+		cfg = &Config{InsecureSkipVerify: true}
+	})
+
+	It("Dials with the default settings when only InsecureSkipVerify is set", func() {
+		conn, err := NewHTTPSTransport(nil, cfg).Dial("tcp", "localhost:8443")
+		Expect(err).NotTo(HaveOccurred())
+		conn.Close()
+	})
+
+	It("Fails to dial when the CA file does not exist", func() {
+		cfg.CAFile = "tests/certs/ca/missing.pem"
+		conn, err := NewHTTPSTransport(nil, cfg).Dial("tcp", "localhost:8443")
+		Expect(conn).To(BeNil())
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Fails to dial with an invalid cipher list", func() {
+		cfg.CipherList = "NOT-A-CIPHER"
+		conn, err := NewHTTPSTransport(nil, cfg).Dial("tcp", "localhost:8443")
+		Expect(conn).To(BeNil())
+		Expect(err).To(HaveOccurred())
+
+		/* OpenSSL's own explanation comes along */
+		Expect(err).To(BeAssignableToTypeOf(&crypto.OpenSSLError{}))
+		Expect(err.(*crypto.OpenSSLError).Entries).NotTo(BeEmpty())
+		Expect(err.Error()).To(ContainSubstring("no cipher match"))
+	})
+
+	It("Rejects a minimum protocol version above the maximum", func() {
+		cfg.MinVersion = TLS1_3_VERSION
+		cfg.MaxVersion = TLS1_2_VERSION
+		conn, err := NewHTTPSTransport(nil, cfg).Dial("tcp", "localhost:8443")
+		Expect(conn).To(BeNil())
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Presents a client certificate from CertFile and KeyFile", func() {
+		cfg.CertFile = "tests/certs/client/client.pem"
+		cfg.KeyFile = "tests/certs/client/client.key"
+		conn, err := NewHTTPSTransport(nil, cfg).Dial("tcp", "localhost:8443")
+		Expect(err).NotTo(HaveOccurred())
+		conn.Close()
+	})
+})
+
+var _ = Describe("Server names", func() {
+	var serverCfg *Config
+
+	BeforeEach(func() {
+		serverCfg = &Config{
+			CertFile: "tests/certs/server/server.pem",
+			KeyFile:  "tests/certs/server/server.key",
+			Certificates: map[string]KeyPair{
+				"a.test":      {"tests/certs/sni/a.test.pem", "tests/certs/sni/a.test.key"},
+				"*.wild.test": {"tests/certs/sni/wild.test.pem", "tests/certs/sni/wild.test.key"},
+				"b.wild.test": {"tests/certs/sni/a.test.pem", "tests/certs/sni/a.test.key"},
+			},
+		}
+	})
+
+	/* presented returns the common name of the certificate presented for name */
+	presented := func(name string) string {
+		client, server := net.Pipe()
+		defer server.Close()
+
+		go func() {
+			c, e := NewServerConn(server, serverCfg)
+			if e == nil {
+				c.Handshake()
+				c.Close()
+			}
+		}()
+
+		c, e := Client(client, &Config{ServerName: name, InsecureSkipVerify: true})
+		Expect(e).To(BeNil())
+		defer c.Close()
+
+		Expect(c.Handshake()).To(BeNil())
+		certs := c.ConnectionState().PeerCertificates
+		Expect(certs).To(HaveLen(1))
+		return certs[0].Subject.CommonName
+	}
+
+	It("Presents the certificate for an exact name", func() {
+		Expect(presented("a.test")).To(Equal("a.test"))
+		Expect(presented("A.Test")).To(Equal("a.test"))
+	})
+
+	It("Matches wildcards against a single label", func() {
+		Expect(presented("x.wild.test")).To(Equal("*.wild.test"))
+		Expect(presented("x.y.wild.test")).To(Equal("bluemix.net"))
+		Expect(presented("wild.test")).To(Equal("bluemix.net"))
+	})
+
+	It("Prefers exact names to wildcards", func() {
+		Expect(presented("b.wild.test")).To(Equal("a.test"))
+	})
+
+	It("Presents the default certificate without SNI or for unknown names", func() {
+		Expect(presented("")).To(Equal("bluemix.net"))
+		Expect(presented("other.test")).To(Equal("bluemix.net"))
+	})
+
+	It("Fails when a key pair cannot be loaded", func() {
+		serverCfg.Certificates["c.test"] = KeyPair{"tests/certs/sni/missing.pem", "tests/certs/sni/missing.key"}
+		_, e := NewServerConn(nil, serverCfg)
+		Expect(e).To(HaveOccurred())
+		Expect(e.Error()).To(ContainSubstring("c.test"))
+	})
+})
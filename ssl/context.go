@@ -2,23 +2,105 @@ package ssl
 
 import (
 	"errors"
+	"fmt"
+
 	"github.com/IBM-Bluemix/golang-openssl-wrapper/crypto"
 )
 
-func ctxInit(config string, method SSL_METHOD) (SSL_CTX, error) {
-	SSL_load_error_strings()
-	if SSL_library_init() != 1 {
-		return nil, errors.New("Unable to initialize libssl")
-	}
-	crypto.OPENSSL_config(config)
+// ctxInit creates an SSL_CTX for method and configures it from cfg.
+// client selects client-side defaults, such as always verifying the peer.
+// OpenSSL failures are returned as a *crypto.OpenSSLError.
+func ctxInit(config string, method SSL_METHOD, cfg *Config, client bool) (SSL_CTX, error) {
+	var ctx SSL_CTX
+
+	err := crypto.WithErrorQueue(func() error {
+		SSL_load_error_strings()
+		if SSL_library_init() != 1 {
+			return crypto.NewOpenSSLError("Unable to initialize libssl")
+		}
+		crypto.OPENSSL_config(config)
+
+		ctx = SSL_CTX_new(method)
+		if ctx == nil {
+			return crypto.NewOpenSSLError("Unable to initialize SSL context")
+		}
 
-	ctx := SSL_CTX_new(method)
-	if ctx == nil {
-		return nil, errors.New("Unable to initialize SSL context")
+		if err := cfg.apply(ctx, client); err != nil {
+			SSL_CTX_free(ctx)
+			ctx = nil
+			return err
+		}
+		return nil
+	})
+
+	return ctx, err
+}
+
+// serverCtxInit creates a server SSL_CTX from cfg presenting the key pair in
+// the PEM files cf and kf, or one from cfg.Certificates if the client asks
+// for its name.
+func serverCtxInit(method SSL_METHOD, cfg *Config, cf, kf string) (SSL_CTX, error) {
+	ctx, err := ctxInit("", method, cfg, false)
+	if err != nil {
+		return nil, err
 	}
 
-	SSL_CTX_set_verify(ctx, SSL_VERIFY_NONE, nil)
-	SSL_CTX_set_verify_depth(ctx, 4)
+	err = crypto.WithErrorQueue(func() error {
+		if err := useKeyPair(ctx, cf, kf); err != nil {
+			return err
+		}
+		if cfg != nil && len(cfg.Certificates) > 0 {
+			return useServerNames(ctx, method, cfg)
+		}
+		return nil
+	})
+	if err != nil {
+		SSL_CTX_free(ctx)
+		return nil, err
+	}
 
 	return ctx, nil
 }
+
+// useServerNames makes ctx present the key pair of each name in
+// cfg.Certificates to clients asking for it through SNI.  Like useKeyPair, it
+// must run within crypto.WithErrorQueue.
+func useServerNames(ctx SSL_CTX, method SSL_METHOD, cfg *Config) error {
+	/* Names sharing a key pair share its SSL_CTX, which ctx keeps a reference to */
+	loaded := make(map[KeyPair]SSL_CTX)
+	defer func() {
+		for _, named := range loaded {
+			SSL_CTX_free(named)
+		}
+	}()
+
+	for name, kp := range cfg.Certificates {
+		if name == "" {
+			return errors.New("Certificates may not hold an empty server name")
+		}
+
+		named, ok := loaded[kp]
+		if !ok {
+			/* The handshake continues with the settings of named, such as ALPN, so it gets all of cfg */
+			var err error
+			named, err = ctxInit("", method, cfg, false)
+			if err != nil {
+				return err
+			}
+			loaded[kp] = named
+
+			if err := useKeyPair(named, kp.CertFile, kp.KeyFile); err != nil {
+				if oe, ok := err.(*crypto.OpenSSLError); ok {
+					oe.Message += " for " + name
+				}
+				return err
+			}
+		}
+
+		if SSL_CTX_add_server_name(ctx, name, named) != 1 {
+			return crypto.NewOpenSSLError(fmt.Sprintf("Unable to add server name %q", name))
+		}
+	}
+
+	return nil
+}
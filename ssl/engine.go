@@ -0,0 +1,431 @@
+package ssl
+
+import (
+	"errors"
+	"io"
+	"net"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/IBM-Bluemix/golang-openssl-wrapper/crypto"
+)
+
+// engine drives an SSL object over any net.Conn.  OpenSSL reads and writes
+// ciphertext through a pair of memory BIOs, and the engine moves the bytes
+// between those and the connection.  All blocking happens in the net.Conn, so
+// its deadlines apply to handshakes, reads and writes alike, and wrapping
+// connections such as proxy tunnels, Unix sockets or net.Pipe work unchanged.
+//
+// An SSL object may not be used from two goroutines at once, so every call
+// into OpenSSL is made with mu held.  The lock is released while waiting on
+// the connection, which lets a reader and a writer proceed independently.
+type engine struct {
+	conn net.Conn
+
+	mu     sync.Mutex
+	ssl    SSL
+	rbio   BIO
+	wbio   BIO
+	closed bool
+
+	/* closing is set by the first Close; wclosed once close_notify is on its way */
+	closing bool
+	wclosed bool
+
+	/* rmu serializes reads from conn, which fills counts */
+	rmu   sync.Mutex
+	rbuf  []byte
+	rerr  error
+	fills int
+
+	/* wmu keeps records in order on conn; a failed write spoils the stream for good */
+	wmu  sync.Mutex
+	werr error
+
+	/* The handshake runs once; its result is kept for later callers */
+	hsMu   sync.Mutex
+	hsDone bool
+	hsErr  error
+
+	/* sessions, if set before the handshake, is given each session the server hands out */
+	sessions func(SSL)
+}
+
+// engineReadSize is the amount of ciphertext read from the connection at
+// once, enough for a full TLS record.
+const engineReadSize = 17 << 10
+
+// closeNotifyTimeout bounds the time Close spends sending close_notify and
+// waiting for the peer's.
+const closeNotifyTimeout = 1 * time.Second
+
+var (
+	errClosed      = errors.New("Use of closed connection")
+	errWriteClosed = errors.New("Use of connection closed for writing")
+	errEarlyClose  = errors.New("CloseWrite before the handshake has completed")
+)
+
+// newEngine attaches memory BIOs to s for use over c.
+func newEngine(c net.Conn, s SSL) (*engine, error) {
+	if SSL_set_mem_bios(s) != 1 {
+		return nil, errors.New("Unable to attach memory BIOs to SSL")
+	}
+
+	/* Our write buffer is copied on every call, so retries must not care where it lives */
+	SSL_set_mode(s, int64(SSL_MODE_ACCEPT_MOVING_WRITE_BUFFER))
+
+	return &engine{
+		conn: c,
+		ssl:  s,
+		rbio: SSL_get_rbio(s),
+		wbio: SSL_get_wbio(s),
+	}, nil
+}
+
+// do calls op until it succeeds, sending whatever OpenSSL has written and
+// reading more ciphertext whenever it runs out.  It returns op's result and,
+// on failure, the SSL_get_error() code alongside the error.  If OpenSSL
+// itself fails, the error is an Error naming the operation as what.
+func (e *engine) do(what string, op func(SSL) int) (int, int, error) {
+	return e.run(what, op, false)
+}
+
+// run is do, except that if background is true the output of a successful op
+// is sent on its own goroutine.  Later writes still wait for it.
+func (e *engine) run(what string, op func(SSL) int, background bool) (int, int, error) {
+	for {
+		e.mu.Lock()
+		if e.closed {
+			e.mu.Unlock()
+			return 0, SSL_ERROR_NONE, errClosed
+		}
+		fills := e.fills
+		ret, code, entries := e.call(op)
+		out := e.pending()
+		if out != nil {
+			/* Taken before mu is released, so records reach conn in the order they were made */
+			e.wmu.Lock()
+		}
+		e.mu.Unlock()
+
+		if out != nil {
+			if background && code == SSL_ERROR_NONE {
+				go func() {
+					e.flush(out)
+					e.wmu.Unlock()
+				}()
+			} else {
+				err := e.flush(out)
+				e.wmu.Unlock()
+				if err != nil {
+					return 0, code, err
+				}
+			}
+		}
+
+		var err error
+		switch code {
+		case SSL_ERROR_NONE:
+			return ret, code, nil
+		case SSL_ERROR_WANT_READ:
+			err = e.fill(fills)
+		case SSL_ERROR_WANT_WRITE:
+			/* The output was sent above */
+		case SSL_ERROR_ZERO_RETURN:
+			return 0, code, io.EOF
+		default:
+			return ret, code, Error{Op: what, Code: code, Entries: entries}
+		}
+
+		/* Deadline errors from conn already satisfy net.Error with Timeout() == true */
+		if err != nil {
+			return 0, code, err
+		}
+	}
+}
+
+// call runs op and classifies its result with SSL_get_error().  On failure,
+// the entries OpenSSL added to the error queue are returned too.  It must be
+// called with mu held.
+func (e *engine) call(op func(SSL) int) (int, int, []crypto.ErrorEntry) {
+	/* The queue is per thread, and SSL_get_error() must not see stale entries */
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	crypto.ERR_clear_error()
+
+	ret := op(e.ssl)
+	if ret > 0 {
+		return ret, SSL_ERROR_NONE, nil
+	}
+
+	code := SSL_get_error(e.ssl, ret)
+	switch code {
+	case SSL_ERROR_SSL, SSL_ERROR_SYSCALL:
+		return ret, code, crypto.GetErrors()
+	}
+	return ret, code, nil
+}
+
+// pending takes the ciphertext OpenSSL has written.  It must be called with
+// mu held.
+func (e *engine) pending() []byte {
+	n := BIO_ctrl_pending(e.wbio)
+	if n <= 0 {
+		return nil
+	}
+
+	out := make([]byte, n)
+	m := BIO_read(e.wbio, out[:len(out):len(out)], len(out))
+	if m <= 0 {
+		return nil
+	}
+	return out[:m]
+}
+
+// flush writes out to the connection.  It must be called with wmu held.
+func (e *engine) flush(out []byte) error {
+	if e.werr == nil {
+		_, e.werr = e.conn.Write(out)
+	}
+	return e.werr
+}
+
+// fill reads ciphertext from the connection into OpenSSL.  seen is the
+// number of fills the caller had observed; if another goroutine has filled
+// since, the caller should simply try again.
+func (e *engine) fill(seen int) error {
+	e.rmu.Lock()
+	defer e.rmu.Unlock()
+
+	e.mu.Lock()
+	filled := e.fills != seen
+	e.mu.Unlock()
+	if filled {
+		return nil
+	}
+	if e.rerr != nil {
+		return e.rerr
+	}
+
+	if e.rbuf == nil {
+		e.rbuf = make([]byte, engineReadSize)
+	}
+	n, err := e.conn.Read(e.rbuf)
+	if n > 0 {
+		e.mu.Lock()
+		if !e.closed {
+			BIO_write(e.rbio, e.rbuf[:n], n)
+		}
+		e.fills++
+		e.mu.Unlock()
+	}
+
+	if err != nil {
+		/* A timeout can be retried after moving the deadline; anything else is final */
+		if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+			e.rerr = err
+		}
+		if n > 0 {
+			return nil
+		}
+	}
+	return err
+}
+
+// handshake runs the TLS handshake as a client, or as a server if accept is
+// true.  If check is not nil, it is given the SSL object and the outcome of
+// the handshake, for instance to verify the peer, and returns the final
+// result.  Only the first call does any work; later calls return its result.
+//
+// The last flight of the handshake is sent in the background.  The peer does
+// not answer it, and over an unbuffered connection such as net.Pipe, waiting
+// for the peer to read it could deadlock with the peer's first write.
+func (e *engine) handshake(accept bool, check func(SSL, error) error) error {
+	e.hsMu.Lock()
+	defer e.hsMu.Unlock()
+
+	if e.hsDone {
+		return e.hsErr
+	}
+
+	op := SSL_connect
+	if accept {
+		op = SSL_accept
+	}
+
+	_, _, err := e.run("handshake", op, true)
+	if err == nil {
+		e.collectSessions()
+	}
+	if check != nil {
+		e.mu.Lock()
+		if !e.closed {
+			err = check(e.ssl, err)
+		}
+		e.mu.Unlock()
+	}
+
+	e.hsErr = err
+	e.hsDone = true
+	return err
+}
+
+// collectSessions passes any session the server has handed out since the
+// last call to sessions.  TLS 1.3 servers send them after the handshake, so
+// they turn up while reading.
+func (e *engine) collectSessions() {
+	if e.sessions == nil {
+		return
+	}
+
+	e.inspect(func(s SSL) {
+		if SSL_take_new_session(s) == 1 {
+			e.sessions(s)
+		}
+	})
+}
+
+// inspect calls f with the SSL object, unless it has been freed, so that f
+// can query it safely.
+func (e *engine) inspect(f func(SSL)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.closed {
+		f(e.ssl)
+	}
+}
+
+// closeWrite sends a close_notify alert to the peer, unless it has already
+// been sent.  Later writes fail.  It does not wait for the peer's own
+// close_notify.  If background is true, the alert is sent on its own
+// goroutine, as in handshake, so that both ends can close at once over an
+// unbuffered connection.
+func (e *engine) closeWrite(background bool) error {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return errClosed
+	}
+	if SSL_is_init_finished(e.ssl) != 1 {
+		e.mu.Unlock()
+		return errEarlyClose
+	}
+	sent := e.wclosed
+	e.wclosed = true
+	e.mu.Unlock()
+
+	if sent {
+		return nil
+	}
+
+	_, _, err := e.run("shutdown", func(s SSL) int {
+		/* 0 means our alert was sent and the peer's has not arrived yet */
+		if r := SSL_shutdown(s); r != 0 {
+			return r
+		}
+		return 1
+	}, background)
+	return err
+}
+
+// awaitClose reads until the peer's close_notify arrives, discarding any
+// data sent before it.  A peer which simply closes the connection counts
+// too.
+func (e *engine) awaitClose() error {
+	buf := make([]byte, 4096)
+	for {
+		received := false
+		e.inspect(func(s SSL) {
+			received = SSL_get_shutdown(s)&SSL_RECEIVED_SHUTDOWN != 0
+		})
+		if received {
+			return nil
+		}
+
+		if _, err := e.read(buf); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// beginClose reports whether this is the first call, which alone goes on to
+// close the connection.  Reads and writes keep working until free.
+func (e *engine) beginClose() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	first := !e.closing
+	e.closing = true
+	return first
+}
+
+// shutdown runs a bidirectional TLS shutdown, giving up once timeout has
+// passed.  It is a courtesy to the peer, so its errors are not reported.
+func (e *engine) shutdown(timeout time.Duration) {
+	e.conn.SetDeadline(time.Now().Add(timeout))
+	if e.closeWrite(true) == nil {
+		e.awaitClose()
+	}
+}
+
+func (e *engine) read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	/* The buffer is copied back up to its capacity, so that is cut to its length */
+	b = b[:len(b):len(b)]
+	n, code, err := e.do("read", func(s SSL) int {
+		return SSL_read(s, b, len(b))
+	})
+	e.collectSessions()
+	if err == io.EOF || (code == SSL_ERROR_SYSCALL && n == 0) {
+		/* Only the peer's close_notify ends the stream; without it, data may have been cut off */
+		received := false
+		e.inspect(func(s SSL) {
+			received = SSL_get_shutdown(s)&SSL_RECEIVED_SHUTDOWN != 0
+		})
+		if !received {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return 0, io.EOF
+	}
+	return n, err
+}
+
+func (e *engine) write(b []byte) (int, error) {
+	e.mu.Lock()
+	wclosed := e.wclosed
+	e.mu.Unlock()
+	if wclosed {
+		return 0, errWriteClosed
+	}
+
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	n, _, err := e.do("write", func(s SSL) int {
+		return SSL_write(s, b, len(b))
+	})
+	return n, err
+}
+
+// free releases the SSL object and its BIOs.  It reports false if it was
+// already freed.
+func (e *engine) free() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return false
+	}
+	e.closed = true
+	SSL_free(e.ssl)
+	return true
+}
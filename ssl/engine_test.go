@@ -0,0 +1,321 @@
+package ssl_test
+
+import (
+	. "github.com/IBM-Bluemix/golang-openssl-wrapper/ssl"
+
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Engine", func() {
+	var (
+		client, server net.Conn
+		serverCfg      *Config
+	)
+
+	BeforeEach(func() {
+		client, server = net.Pipe()
+		serverCfg = &Config{
+			CertFile: "tests/certs/server/server.pem",
+			KeyFile:  "tests/certs/server/server.key",
+		}
+	})
+
+	AfterEach(func() {
+		client.Close()
+		server.Close()
+	})
+
+	/* echo answers one line on a server-side Conn over the pipe */
+	echo := func(cfg *Config) chan error {
+		done := make(chan error, 1)
+		go func() {
+			c, e := NewServerConn(server, cfg)
+			if e != nil {
+				done <- e
+				return
+			}
+			defer c.Close()
+
+			line, e := bufio.NewReader(c).ReadString('\n')
+			if e == nil {
+				_, e = c.Write([]byte("echo: " + line))
+			}
+			done <- e
+		}()
+		return done
+	}
+
+	It("Runs TLS over net.Pipe", func() {
+		done := echo(serverCfg)
+
+		c, e := Client(client, &Config{InsecureSkipVerify: true})
+		Expect(e).To(BeNil())
+		defer c.Close()
+
+		_, e = c.Write([]byte("hello\n"))
+		Expect(e).To(BeNil())
+		line, e := bufio.NewReader(c).ReadString('\n')
+		Expect(e).To(BeNil())
+		Expect(line).To(Equal("echo: hello\n"))
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("Runs TLS 1.2 over net.Pipe", func() {
+		serverCfg.MaxVersion = TLS1_2_VERSION
+		done := echo(serverCfg)
+
+		c, e := Client(client, &Config{InsecureSkipVerify: true})
+		Expect(e).To(BeNil())
+		defer c.Close()
+
+		Expect(c.Handshake()).To(BeNil())
+		_, e = c.Write([]byte("hello\n"))
+		Expect(e).To(BeNil())
+		line, e := bufio.NewReader(c).ReadString('\n')
+		Expect(e).To(BeNil())
+		Expect(line).To(Equal("echo: hello\n"))
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("Leaves the spare capacity of a read buffer alone", func() {
+		done := echo(serverCfg)
+
+		c, e := Client(client, &Config{InsecureSkipVerify: true})
+		Expect(e).To(BeNil())
+		defer c.Close()
+
+		_, e = c.Write([]byte("hello\n"))
+		Expect(e).To(BeNil())
+
+		backing := bytes.Repeat([]byte{0xff}, 64)
+		n, e := c.Read(backing[:4])
+		Expect(e).To(BeNil())
+		Expect(n).To(Equal(4))
+		Expect(string(backing[:4])).To(Equal("echo"))
+		Expect(backing[4:]).To(Equal(bytes.Repeat([]byte{0xff}, 60)))
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("Requires ServerName or InsecureSkipVerify", func() {
+		_, e := Client(client, &Config{})
+		Expect(e).NotTo(BeNil())
+
+		_, e = Client(client, nil)
+		Expect(e).NotTo(BeNil())
+	})
+
+	It("Requires a key pair on the server", func() {
+		_, e := NewServerConn(server, &Config{})
+		Expect(e).NotTo(BeNil())
+	})
+
+	It("Verifies the server named in ServerName", func() {
+		echo(serverCfg)
+
+		c, e := Client(client, &Config{ServerName: "bluemix.net"})
+		Expect(e).To(BeNil())
+		defer c.Close()
+
+		e = c.Handshake()
+		Expect(e).To(BeAssignableToTypeOf(VerifyError{}))
+		Expect(e.(VerifyError).UnknownIssuer()).To(BeTrue())
+
+		/* The result sticks */
+		_, e = c.Write([]byte("hello\n"))
+		Expect(e).To(BeAssignableToTypeOf(VerifyError{}))
+	})
+
+	It("Reports why OpenSSL failed the handshake", func() {
+		serverCfg.MaxVersion = TLS1_2_VERSION
+		echo(serverCfg)
+
+		c, e := Client(client, &Config{InsecureSkipVerify: true, MinVersion: TLS1_3_VERSION})
+		Expect(e).To(BeNil())
+		defer c.Close()
+
+		e = c.Handshake()
+		Expect(e).To(BeAssignableToTypeOf(Error{}))
+		Expect(e.(Error).Op).To(Equal("handshake"))
+		Expect(e.(Error).Code).To(Equal(SSL_ERROR_SSL))
+		Expect(e.(Error).Entries).NotTo(BeEmpty())
+		Expect(e.Error()).To(ContainSubstring("SSL_ERROR_SSL"))
+	})
+
+	It("Honors deadlines on the underlying connection", func() {
+		c, e := Client(client, &Config{InsecureSkipVerify: true})
+		Expect(e).To(BeNil())
+		defer c.Close()
+
+		/* Nobody reads the other end of the pipe */
+		c.SetDeadline(time.Now().Add(100 * time.Millisecond))
+		e = c.Handshake()
+		Expect(e).NotTo(BeNil())
+		ne, ok := e.(net.Error)
+		Expect(ok).To(BeTrue())
+		Expect(ne.Timeout()).To(BeTrue())
+	})
+})
+
+var _ = Describe("Shutdown", func() {
+	var (
+		client, server net.Conn
+		serverCfg      *Config
+	)
+
+	BeforeEach(func() {
+		client, server = net.Pipe()
+		serverCfg = &Config{
+			CertFile: "tests/certs/server/server.pem",
+			KeyFile:  "tests/certs/server/server.key",
+		}
+	})
+
+	AfterEach(func() {
+		client.Close()
+		server.Close()
+	})
+
+	/* connect returns both ends of a TLS connection over the pipe once the handshake is done */
+	connect := func() (HTTPSConn, Conn) {
+		accepted := make(chan Conn, 1)
+		go func() {
+			defer GinkgoRecover()
+			c, e := NewServerConn(server, serverCfg)
+			Expect(e).To(BeNil())
+			Expect(c.Handshake()).To(Succeed())
+			accepted <- c
+		}()
+
+		c, e := Client(client, &Config{InsecureSkipVerify: true})
+		Expect(e).To(BeNil())
+		Expect(c.Handshake()).To(Succeed())
+
+		var s Conn
+		Eventually(accepted).Should(Receive(&s))
+		return c, s
+	}
+
+	It("Half-closes the connection with CloseWrite", func() {
+		c, s := connect()
+		defer c.Close()
+
+		read := make(chan string, 1)
+		go func() {
+			defer GinkgoRecover()
+			defer s.Close()
+
+			/* close_notify ends the stream cleanly */
+			data, e := ioutil.ReadAll(s)
+			Expect(e).To(BeNil())
+			read <- string(data)
+
+			_, e = s.Write([]byte("bye\n"))
+			Expect(e).To(BeNil())
+		}()
+
+		_, e := c.Write([]byte("hello\n"))
+		Expect(e).To(BeNil())
+		Expect(c.CloseWrite()).To(Succeed())
+		Expect(c.CloseWrite()).To(Succeed())
+
+		_, e = c.Write([]byte("more\n"))
+		Expect(e).To(HaveOccurred())
+		Eventually(read).Should(Receive(Equal("hello\n")))
+
+		/* The other direction stays open */
+		line, e := bufio.NewReader(c).ReadString('\n')
+		Expect(e).To(BeNil())
+		Expect(line).To(Equal("bye\n"))
+	})
+
+	It("Refuses CloseWrite before the handshake", func() {
+		c, e := Client(client, &Config{InsecureSkipVerify: true})
+		Expect(e).To(BeNil())
+		defer c.Close()
+
+		Expect(c.CloseWrite()).NotTo(Succeed())
+	})
+
+	It("Waits on Close for the peer's close_notify", func() {
+		c, s := connect()
+
+		serverClosed := make(chan error, 1)
+		go func() {
+			defer GinkgoRecover()
+			_, e := s.Read(make([]byte, 1))
+			Expect(e).To(Equal(io.EOF))
+
+			time.Sleep(100 * time.Millisecond)
+			serverClosed <- s.Close()
+		}()
+
+		start := time.Now()
+		Expect(c.Close()).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically(">=", 100*time.Millisecond))
+		Eventually(serverClosed).Should(Receive(BeNil()))
+	})
+
+	It("Gives up waiting for the peer after a while", func() {
+		c, s := connect()
+		defer s.Close()
+
+		/* Nobody reads the other end of the pipe */
+		start := time.Now()
+		Expect(c.Close()).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+	})
+
+	It("Reports a connection cut without close_notify as unexpected", func() {
+		c, s := connect()
+		defer c.Close()
+		defer s.Close()
+
+		/* The peer's end goes away with no TLS shutdown */
+		server.Close()
+		_, e := c.Read(make([]byte, 1))
+		Expect(e).To(Equal(io.ErrUnexpectedEOF))
+		Expect(e).NotTo(Equal(io.EOF))
+	})
+
+	It("Closes only once, from any goroutine", func() {
+		c, s := connect()
+		defer s.Close()
+
+		read := make(chan error, 1)
+		go func() {
+			_, e := c.Read(make([]byte, 1))
+			read <- e
+		}()
+
+		var (
+			wg        sync.WaitGroup
+			mu        sync.Mutex
+			succeeded int
+		)
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if c.Close() == nil {
+					mu.Lock()
+					succeeded++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		Expect(succeeded).To(Equal(1))
+		Eventually(read, 2*time.Second).Should(Receive(HaveOccurred()))
+		Expect(c.Close()).NotTo(Succeed())
+	})
+})
@@ -0,0 +1,118 @@
+package ssl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/IBM-Bluemix/golang-openssl-wrapper/crypto"
+)
+
+// Error is returned when a TLS operation such as the handshake, a read or a
+// write fails inside OpenSSL.  Code classifies the failure with the
+// SSL_ERROR_* value reported by SSL_get_error(), and Entries holds what
+// OpenSSL left in its error queue, earliest first.
+type Error struct {
+	Op      string
+	Code    int
+	Entries []crypto.ErrorEntry
+}
+
+func (e Error) Error() string {
+	s := fmt.Sprintf("SSL %s failed (%s)", e.Op, errorCodeName(e.Code))
+	if len(e.Entries) == 0 {
+		return s
+	}
+
+	entries := make([]string, len(e.Entries))
+	for i, entry := range e.Entries {
+		entries[i] = entry.String()
+	}
+	return s + ": " + strings.Join(entries, "; ")
+}
+
+// errorCodeName returns the name of an SSL_ERROR_* value.
+func errorCodeName(code int) string {
+	switch code {
+	case SSL_ERROR_NONE:
+		return "SSL_ERROR_NONE"
+	case SSL_ERROR_SSL:
+		return "SSL_ERROR_SSL"
+	case SSL_ERROR_WANT_READ:
+		return "SSL_ERROR_WANT_READ"
+	case SSL_ERROR_WANT_WRITE:
+		return "SSL_ERROR_WANT_WRITE"
+	case SSL_ERROR_WANT_X509_LOOKUP:
+		return "SSL_ERROR_WANT_X509_LOOKUP"
+	case SSL_ERROR_SYSCALL:
+		return "SSL_ERROR_SYSCALL"
+	case SSL_ERROR_ZERO_RETURN:
+		return "SSL_ERROR_ZERO_RETURN"
+	case SSL_ERROR_WANT_CONNECT:
+		return "SSL_ERROR_WANT_CONNECT"
+	case SSL_ERROR_WANT_ACCEPT:
+		return "SSL_ERROR_WANT_ACCEPT"
+	}
+	return fmt.Sprintf("SSL error %d", code)
+}
+
+// VerifyError is returned when the peer's certificate chain could not be
+// validated against the trust store.
+// Code holds the X509_V_ERR_* value reported by SSL_get_verify_result().
+type VerifyError struct {
+	Host   string
+	Code   int
+	Reason string
+}
+
+func (e VerifyError) Error() string {
+	return fmt.Sprintf("Certificate verification failed for %s: %s (%d)", e.Host, e.Reason, e.Code)
+}
+
+// Expired reports whether verification failed because a certificate in the
+// chain has expired or is not yet valid.
+func (e VerifyError) Expired() bool {
+	return e.Code == X509_V_ERR_CERT_HAS_EXPIRED || e.Code == X509_V_ERR_CERT_NOT_YET_VALID
+}
+
+// UnknownIssuer reports whether verification failed because the chain does
+// not lead to a trusted root.
+func (e VerifyError) UnknownIssuer() bool {
+	switch e.Code {
+	case X509_V_ERR_UNABLE_TO_GET_ISSUER_CERT,
+		X509_V_ERR_UNABLE_TO_GET_ISSUER_CERT_LOCALLY,
+		X509_V_ERR_UNABLE_TO_VERIFY_LEAF_SIGNATURE,
+		X509_V_ERR_DEPTH_ZERO_SELF_SIGNED_CERT,
+		X509_V_ERR_SELF_SIGNED_CERT_IN_CHAIN,
+		X509_V_ERR_CERT_UNTRUSTED:
+		return true
+	}
+	return false
+}
+
+// HostnameError is returned when the peer's certificate is valid but does not
+// match the host name (or IP address) that was dialed, per RFC 6125.
+type HostnameError struct {
+	Host string
+}
+
+func (e HostnameError) Error() string {
+	return fmt.Sprintf("Certificate is not valid for %s", e.Host)
+}
+
+// verifyError builds the error describing why the peer of s failed verification,
+// or returns nil if verification succeeded.
+func verifyError(s SSL, host string) error {
+	code := int(SSL_get_verify_result(s))
+	switch code {
+	case X509_V_OK:
+		return nil
+	case X509_V_ERR_HOSTNAME_MISMATCH, X509_V_ERR_IP_ADDRESS_MISMATCH:
+		return HostnameError{Host: host}
+	}
+
+	return VerifyError{
+		Host:   host,
+		Code:   code,
+		Reason: X509_verify_cert_error_string(int64(code)),
+	}
+}
@@ -0,0 +1,129 @@
+package ssl
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// h2Conn shows http2 the state of a connection, as a *tls.Conn would.
+type h2Conn struct {
+	net.Conn
+	state tls.ConnectionState
+}
+
+func (c h2Conn) ConnectionState() tls.ConnectionState {
+	return c.state
+}
+
+// NewHTTP2Transport returns an http2.Transport which speaks HTTP/2 over
+// OpenSSL.  "h2" is offered through ALPN unless cfg.NextProtos says
+// otherwise, and connections to servers which do not agree to it fail.
+// cfg may be nil to use the default configuration.
+func NewHTTP2Transport(cfg *Config) *http2.Transport {
+	c := Config{}
+	if cfg != nil {
+		c = *cfg
+	}
+	if len(c.NextProtos) == 0 {
+		c.NextProtos = []string{http2.NextProtoTLS}
+	}
+
+	d := &dialer{config: &c}
+	return &http2.Transport{
+		DialTLS: d.dialHTTP2,
+	}
+}
+
+// NewHTTP2Client returns an http.Client which speaks HTTP/2 over OpenSSL.
+// This is a convenience function wrapping NewHTTP2Transport.
+func NewHTTP2Client(cfg *Config) http.Client {
+	return http.Client{
+		Transport: NewHTTP2Transport(cfg),
+	}
+}
+
+// dialHTTP2 dials addr for http2.Transport, which has no tls.Config for us.
+func (d *dialer) dialHTTP2(network, addr string, _ *tls.Config) (net.Conn, error) {
+	c, err := d.dialTLS(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	h := c.(HTTPSConn)
+	state := h.ConnectionState()
+	if state.NegotiatedProtocol != http2.NextProtoTLS {
+		h.Close()
+		return nil, fmt.Errorf("Server at %s did not agree to HTTP/2 through ALPN", addr)
+	}
+
+	return h2Conn{Conn: h, state: *state.tlsState()}, nil
+}
+
+// http2Server returns the HTTP/2 server for connections which negotiate
+// "h2", and the http.Server holding the settings it shares with s.
+func (s *Server) http2Server() (*http2.Server, *http.Server) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.h2Base != nil {
+		return s.h2, s.h2Base
+	}
+
+	s.h2 = s.HTTP2
+	if s.h2 == nil {
+		s.h2 = &http2.Server{}
+	}
+
+	s.h2Base = &http.Server{
+		Handler:           s.Handler,
+		ReadTimeout:       s.ReadTimeout,
+		ReadHeaderTimeout: s.ReadHeaderTimeout,
+		WriteTimeout:      s.WriteTimeout,
+		IdleTimeout:       s.IdleTimeout,
+		ErrorLog:          s.ErrorLog,
+	}
+
+	/* This also lets shutting down h2Base send GOAWAY on every HTTP/2 connection */
+	if err := http2.ConfigureServer(s.h2Base, s.h2); err != nil {
+		s.logf("ERROR: %s", err)
+	}
+	return s.h2, s.h2Base
+}
+
+// serveHTTP2 serves the connection c, on which "h2" was negotiated, until the
+// client or Shutdown ends it.
+func (s *Server) serveHTTP2(c *trackedConn, state *tls.ConnectionState) {
+	h2, base := s.http2Server()
+
+	/* Streams come and go on their own, so the connection is never idle as a whole */
+	if !c.setIdle(false) || s.shuttingDown() {
+		return
+	}
+
+	/* http2 manages the deadlines from here on */
+	c.SetDeadline(time.Time{})
+
+	/* Closing c, rather than its Conn, keeps serve from closing it again */
+	h2.ServeConn(h2Conn{Conn: c, state: *state}, &http2.ServeConnOpts{
+		Handler:    s.Handler,
+		BaseConfig: base,
+	})
+}
+
+// shutdownHTTP2 asks HTTP/2 clients to go away once their streams are done.
+func (s *Server) shutdownHTTP2() {
+	s.mu.Lock()
+	base := s.h2Base
+	s.mu.Unlock()
+
+	if base != nil {
+		/* base has no listeners or connections of its own, so this returns at once */
+		base.Shutdown(context.Background())
+	}
+}
@@ -0,0 +1,134 @@
+package ssl_test
+
+import (
+	. "github.com/IBM-Bluemix/golang-openssl-wrapper/ssl"
+
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ALPN", func() {
+	var serverCfg *Config
+
+	BeforeEach(func() {
+		serverCfg = &Config{
+			CertFile:   "tests/certs/server/server.pem",
+			KeyFile:    "tests/certs/server/server.key",
+			NextProtos: []string{"h2", "http/1.1"},
+		}
+	})
+
+	/* negotiate returns the protocol both ends agree on, or the client's handshake error */
+	negotiate := func(protos ...string) (string, error) {
+		client, server := net.Pipe()
+		defer server.Close()
+
+		go func() {
+			c, e := NewServerConn(server, serverCfg)
+			if e == nil {
+				c.Handshake()
+				c.Close()
+			}
+		}()
+
+		c, e := Client(client, &Config{InsecureSkipVerify: true, NextProtos: protos})
+		Expect(e).To(BeNil())
+		defer c.Close()
+
+		/* A refusal only arrives with the server's first flight */
+		if e = c.Handshake(); e != nil {
+			return "", e
+		}
+		return c.ConnectionState().NegotiatedProtocol, nil
+	}
+
+	It("Picks the server's most preferred protocol", func() {
+		Expect(negotiate("http/1.1", "h2")).To(Equal("h2"))
+		Expect(negotiate("http/1.1")).To(Equal("http/1.1"))
+	})
+
+	It("Negotiates nothing when the client offers nothing", func() {
+		Expect(negotiate()).To(BeEmpty())
+	})
+
+	It("Refuses clients offering no protocol in common", func() {
+		_, e := negotiate("spdy/3")
+		Expect(e).To(HaveOccurred())
+	})
+
+	It("Rejects invalid protocol names", func() {
+		serverCfg.NextProtos = []string{""}
+		_, e := NewServerConn(nil, serverCfg)
+		Expect(e).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("HTTP/2", func() {
+	var (
+		cfg *Config
+		s   *Server
+	)
+
+	BeforeEach(func() {
+		cfg = &Config{
+			CertFile:   "tests/certs/server/server.pem",
+			KeyFile:    "tests/certs/server/server.key",
+			NextProtos: []string{"h2", "http/1.1"},
+		}
+		s = &Server{
+			Handler: http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				fmt.Fprintf(res, "%s %s", req.Proto, req.TLS.NegotiatedProtocol)
+			}),
+		}
+	})
+
+	JustBeforeEach(func() {
+		l, e := Listen("tcp", "localhost:8452", cfg)
+		Expect(e).To(BeNil())
+		go s.Serve(l)
+	})
+
+	AfterEach(func() {
+		s.Close()
+	})
+
+	get := func(c http.Client) (string, error) {
+		res, e := c.Get("https://localhost:8452/")
+		if e != nil {
+			return "", e
+		}
+		defer res.Body.Close()
+
+		body, e := ioutil.ReadAll(res.Body)
+		return string(body), e
+	}
+
+	It("Serves HTTP/2 to clients asking for h2", func() {
+		c := NewHTTP2Client(&Config{InsecureSkipVerify: true})
+		Expect(get(c)).To(Equal("HTTP/2.0 h2"))
+
+		/* Requests share the connection */
+		Expect(get(c)).To(Equal("HTTP/2.0 h2"))
+	})
+
+	It("Keeps serving HTTP/1.1 to other clients", func() {
+		Expect(get(NewInsecureHTTPSClient())).To(Equal("HTTP/1.1 "))
+		Expect(get(NewHTTPSClient(&Config{InsecureSkipVerify: true, NextProtos: []string{"http/1.1"}}))).To(Equal("HTTP/1.1 http/1.1"))
+	})
+
+	Context("Without h2 on the server", func() {
+		BeforeEach(func() {
+			cfg.NextProtos = nil
+		})
+
+		It("Fails HTTP/2 clients", func() {
+			_, e := get(NewHTTP2Client(&Config{InsecureSkipVerify: true}))
+			Expect(e).To(HaveOccurred())
+		})
+	})
+})
@@ -7,11 +7,12 @@ package ssl
 import (
 	"errors"
 	"fmt"
-	"github.com/IBM-Bluemix/golang-openssl-wrapper/bio"
 	"net"
 	"net/http"
 	"net/url"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -25,122 +26,185 @@ var networksAllowed = map[string]bool{
 }
 
 // HTTPSConn extends net.Conn to provide HTTPS functions using OpenSSL.
+// The embedded net.Conn is the underlying connection; its deadlines apply
+// to the handshake, reads and writes on the HTTPSConn.
 type HTTPSConn struct {
 	net.Conn
 	desthost   string
+	servername string
+	verify     bool
 	connected  bool
 	ctx        SSL_CTX
 	sslInst    SSL
-	sslBio     bio.BIO
-	remoteAddr *net.TCPAddr
-	localAddr  *net.TCPAddr
+	engine     *engine
 }
 
-// Read reads n bytes from the connection into b.
-// Read returns the number of bytes read or 0 and an error if the underlying read fails.
-func (h HTTPSConn) Read(b []byte) (n int, err error) {
-	ret := bio.BIO_read(h.sslBio, b, len(b))
-	if ret < 0 {
-		return ret, fmt.Errorf("Possible socket read error - got %d from BIO_read()", ret)
+// Client returns a client-side TLS connection over conn, much like
+// crypto/tls.Client.  cfg.ServerName is sent in SNI and checked against the
+// server's certificate, so it must be set unless cfg.InsecureSkipVerify is.
+// The handshake runs on the first Read or Write, or when Handshake is called.
+func Client(conn net.Conn, cfg *Config) (HTTPSConn, error) {
+	if cfg == nil || (cfg.ServerName == "" && !cfg.InsecureSkipVerify) {
+		return HTTPSConn{}, errors.New("Either ServerName or InsecureSkipVerify must be set in the Config")
 	}
-	return ret, nil
-}
 
-// Write writes n bytes from b onto the connection.
-// Write returns the number of bytes written and any error that occurred.
-func (h HTTPSConn) Write(b []byte) (n int, err error) {
-	ret := bio.BIO_write(h.sslBio, string(b), len(b))
-	if ret != len(b) {
-		return ret, fmt.Errorf("SSL socket write failed; only %d bytes written out of %d", ret, len(b))
+	ctx, err := ctxInit("", SSLv23_client_method(), cfg, true)
+	if err != nil {
+		return HTTPSConn{}, err
+	}
+
+	h, err := newClientConn(conn, ctx, cfg.ServerName, !cfg.InsecureSkipVerify)
+	if err != nil {
+		SSL_CTX_free(ctx)
+		return HTTPSConn{}, err
 	}
 
-	return ret, nil
+	if cfg.ClientSessionCache != nil {
+		h.useSessionCache(cfg.ClientSessionCache, cfg.ServerName, conn.RemoteAddr().String())
+	}
+
+	return h, nil
 }
 
-// Close closes the underlying connection.
-// Close will return an error if it is invoked on a partially or already closed connection.
-func (h HTTPSConn) Close() error {
-	if (h.ctx != nil) && (h.sslInst != nil) && (h.sslBio != nil) {
-		SSL_CTX_free(h.ctx)
-		h.ctx = nil
-		SSL_free(h.sslInst)
-		h.sslInst = nil
-		bio.BIO_free_all(h.sslBio)
-		h.sslBio = nil
-		return nil
+// newClientConn prepares an HTTPSConn over c using a new SSL object from ctx,
+// which the HTTPSConn frees on Close.
+func newClientConn(c net.Conn, ctx SSL_CTX, servername string, verify bool) (HTTPSConn, error) {
+	sslInst, err := sslInit(ctx, servername, verify)
+	if err != nil {
+		return HTTPSConn{}, err
 	}
 
-	if (h.ctx != nil) || (h.sslInst != nil) || (h.sslBio != nil) {
-		return errors.New("HTTPSConn in partially closed state, not all objects freed, unable to close further")
+	e, err := newEngine(c, sslInst)
+	if err != nil {
+		SSL_free(sslInst)
+		return HTTPSConn{}, err
 	}
 
-	return errors.New("Attempted to close already closed HTTPSConn")
+	return HTTPSConn{
+		Conn:       c,
+		desthost:   c.RemoteAddr().String(),
+		servername: servername,
+		verify:     verify,
+		ctx:        ctx,
+		sslInst:    sslInst,
+		engine:     e,
+	}, nil
 }
 
-// LocalAddr returns the local address as a net.Addr.
-func (h HTTPSConn) LocalAddr() net.Addr {
-	return h.localAddr
+// Handshake runs the TLS handshake and verifies the server unless it has
+// already done so.  Read and Write call it as needed.
+// If the deadline passes, the error is a net.Error with Timeout() == true.
+func (h HTTPSConn) Handshake() error {
+	return h.connect(h.servername, h.verify)
 }
 
-// RemoteAddr returns the remote address for the connection as a net.Addr.
-func (h HTTPSConn) RemoteAddr() net.Addr {
-	return h.remoteAddr
+// Read reads n bytes from the connection into b.
+// Read returns the number of bytes read or 0 and an error if the underlying read fails.
+// If the read deadline passes, the error is a net.Error with Timeout() == true.
+// Read returns io.EOF once the server's close_notify arrives, and
+// io.ErrUnexpectedEOF if the connection ends without one.
+func (h HTTPSConn) Read(b []byte) (n int, err error) {
+	if err = h.Handshake(); err != nil {
+		return 0, err
+	}
+	return h.engine.read(b)
 }
 
-func validateDeadline(t time.Time) error {
-	now := time.Now()
-	if t.Equal(now) || t.Before(now) {
-		return errors.New("Invalid deadline")
+// Write writes n bytes from b onto the connection.
+// Write returns the number of bytes written and any error that occurred.
+// If the write deadline passes, the error is a net.Error with Timeout() == true.
+func (h HTTPSConn) Write(b []byte) (n int, err error) {
+	if err = h.Handshake(); err != nil {
+		return 0, err
 	}
+	return h.engine.write(b)
+}
 
-	if t.After(now.Add(time.Duration(10) * time.Minute)) {
-		return errors.New("Deadline beyond allowed horizon")
+// Close shuts TLS down, sending a close_notify alert and waiting for the
+// server's, for up to a second, then closes the underlying connection.
+// Close may be called from any goroutine, even during a Read or Write, which
+// then fail.
+// Close will return an error if it is invoked on an already closed connection.
+func (h HTTPSConn) Close() error {
+	if !h.engine.beginClose() {
+		return errors.New("Attempted to close already closed HTTPSConn")
 	}
 
-	return nil
+	h.engine.shutdown(closeNotifyTimeout)
+	h.engine.free()
+	SSL_CTX_free(h.ctx)
+	return h.Conn.Close()
 }
 
-// TODO: implement Set[{Read,Write}]Deadline
-
-// // SetDeadLine sets the deadline for both reads and writes.
-// // t should be a time.Time representing a relative interval, such as 10 minutes.
-// // SetDeadline, SetReadDeadline, and SetWriteDeadLine will all return an error
-// // if t equals the current time or is before it.
-// // They will also return an error for an interval longer than 10 minutes.
-// func (h HTTPSConn) SetDeadLine(t time.Time) error {
-// 	return validateDeadline(t)
-// }
-
-// // SetReadDeadLine sets the deadline for reads.
-// func (h HTTPSConn) SetReadDeadLine(t time.Time) error {
-// 	return validateDeadline(t)
-// }
-
-// // SetWriteDeadLine sets the deadline for writes.
-// func (h HTTPSConn) SetWriteDeadLine(t time.Time) error {
-// 	return validateDeadline(t)
-// }
+// CloseWrite sends a close_notify alert, telling the server that no more data
+// follows.  Writes fail from then on, while Read carries on until the
+// server's own close_notify, when it returns io.EOF.  The underlying
+// connection stays open until Close.
+func (h HTTPSConn) CloseWrite() error {
+	return h.engine.closeWrite(false)
+}
 
 /*
  * Setup the Transport
  */
 
+// dialer holds the configuration used by an HTTPS transport when it dials,
+// and the SSL_CTX made from it, which every connection shares.
+type dialer struct {
+	config *Config
+
+	mu  sync.Mutex
+	ctx SSL_CTX
+}
+
+// defaultDialer dials with the default configuration.
+var defaultDialer = &dialer{}
+
 func dial(network, addr string) (net.Conn, error) {
 	return dialTLS(network, addr)
 }
 
+// dialTLS dials addr using the default configuration.
+func dialTLS(network, addr string) (net.Conn, error) {
+	return defaultDialer.dialTLS(network, addr)
+}
+
+// context returns the dialer's SSL_CTX, making it on first use, with a
+// reference for a new connection to release.
+func (d *dialer) context() (SSL_CTX, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.ctx == nil {
+		ctx, err := ctxInit("", SSLv23_client_method(), d.config, true)
+		if err != nil {
+			return nil, err
+		}
+		d.ctx = ctx
+
+		/* Transports have no Close, so the dialer lets go of ctx when it is collected */
+		runtime.SetFinalizer(d, (*dialer).free)
+	}
+
+	SSL_CTX_up_ref(d.ctx)
+	return d.ctx, nil
+}
+
+func (d *dialer) free() {
+	SSL_CTX_free(d.ctx)
+}
+
 /*
  * dialTLS() Returns an httpsclient.HTTPSConn instance.
- * We inject the BIO object for use in I/O.
+ * The TCP connection is made by Go, and OpenSSL runs over it.
  * We inject the CTX and SSL objects for use in connection
  * management.
  */
-func dialTLS(network, addr string) (net.Conn, error) {
+func (d *dialer) dialTLS(network, addr string) (net.Conn, error) {
 	var err error
 	var ctx SSL_CTX
-	var conn bio.BIO
 	var dest, dhost, dport string
-	var ra *net.TCPAddr
+	var deadline time.Time
 
 	if !networksAllowed[network] {
 		return nil, fmt.Errorf("Invalid network specified: %q", network)
@@ -162,101 +226,162 @@ func dialTLS(network, addr string) (net.Conn, error) {
 	}
 	dest = net.JoinHostPort(dhost, dport)
 
-	ra, err = net.ResolveTCPAddr(network, dest)
-	if err != nil {
-		return nil, fmt.Errorf("Unable to resolve address %s on network %s", dest, network)
+	if d.config != nil && d.config.HandshakeTimeout > 0 {
+		deadline = time.Now().Add(d.config.HandshakeTimeout)
 	}
 
-	ctx, err = ctxInit("", SSLv23_client_method())
+	nd := net.Dialer{Deadline: deadline}
+	c, err := nd.Dial(network, dest)
 	if err != nil {
 		return nil, err
 	}
 
-	conn, err = sslInit(ctx, dest)
+	ctx, err = d.context()
 	if err != nil {
+		c.Close()
 		return nil, err
 	}
 
-	err = connect(conn)
+	verify := d.config == nil || !d.config.InsecureSkipVerify
+	if d.config != nil && d.config.ServerName != "" {
+		dhost = d.config.ServerName
+	}
+
+	h, err := newClientConn(c, ctx, dhost, verify)
 	if err != nil {
+		SSL_CTX_free(ctx)
+		c.Close()
 		return nil, err
 	}
+	h.desthost = addr
 
-	h := HTTPSConn{
-		desthost:   addr,
-		ctx:        ctx,
-		sslBio:     conn,
-		remoteAddr: ra,
+	if d.config != nil && d.config.ClientSessionCache != nil {
+		h.useSessionCache(d.config.ClientSessionCache, dhost, dest)
 	}
-	return h, nil
 
+	c.SetDeadline(deadline)
+	err = h.Handshake()
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+	c.SetDeadline(time.Time{})
+
+	h.connected = true
+	return h, nil
 }
 
 // NewHTTPSClient returns an http.Client configured to use OpenSSL for TLS.
 // The client cannot be used for non-TLS communications - use a regular http.Client instead.
 // This is a convenience function wrapping NewHTTPSTransport.
-func NewHTTPSClient() http.Client {
+// cfg may be nil to use the default configuration.
+func NewHTTPSClient(cfg *Config) http.Client {
 	return http.Client{
-		Transport: NewHTTPSTransport(nil),
+		Transport: NewHTTPSTransport(nil, cfg),
 	}
 }
 
 // NewHTTPSTransport returns an http.Transport configured to use OpenSSL for TLS.
 // The transport cannot be used for non-TLS communications - use a regular http.Transport instead.
-func NewHTTPSTransport(proxyFunc func(*http.Request) (*url.URL, error)) *http.Transport {
+// Server certificates are verified against the trust store and the requested
+// host name unless cfg.InsecureSkipVerify is set.
+// cfg may be nil to use the default configuration.
+func NewHTTPSTransport(proxyFunc func(*http.Request) (*url.URL, error), cfg *Config) *http.Transport {
+	d := &dialer{config: cfg}
 	h := &http.Transport{
-		Dial:    dialTLS,
-		DialTLS: dialTLS,
+		Dial:    d.dialTLS,
+		DialTLS: d.dialTLS,
 		Proxy:   proxyFunc,
 	}
 	return h
 }
 
-func sslInit(ctx SSL_CTX, hostname string) (bio.BIO, error) {
-	/* Initialize the SSL and connect BIOs */
-	conn := bio.BIO_new_ssl_connect(ctx)
-	if conn == nil {
-		return nil, errors.New("Unable to setup I/O")
-	}
+// NewInsecureHTTPSClient returns an http.Client like NewHTTPSClient, except that
+// server certificates and host names are NOT verified.
+// This leaves connections open to man-in-the-middle attacks and should only be used for testing.
+func NewInsecureHTTPSClient() http.Client {
+	return NewHTTPSClient(&Config{InsecureSkipVerify: true})
+}
 
-	if SSL_CTX_load_verify_locations(ctx, "", "/etc/ssl/certs") != 1 {
-		return nil, errors.New("Unable to load certificates for verification")
-	}
-	if bio.BIO_set_conn_hostname(conn, hostname) != 1 {
-		return nil, errors.New("Unable to set hostname in BIO object")
-	}
+// NewInsecureHTTPSTransport returns an http.Transport like NewHTTPSTransport, except that
+// server certificates and host names are NOT verified.
+// This leaves connections open to man-in-the-middle attacks and should only be used for testing.
+func NewInsecureHTTPSTransport(proxyFunc func(*http.Request) (*url.URL, error)) *http.Transport {
+	return NewHTTPSTransport(proxyFunc, &Config{InsecureSkipVerify: true})
+}
 
+func sslInit(ctx SSL_CTX, hostname string, verify bool) (SSL, error) {
 	/* Setup SSL */
 	sslInst := SSL_new(ctx)
 	if sslInst == nil {
 		return nil, errors.New("Unable to initialize SSL")
 	}
 
-	if bio.BIO_get_ssl(conn, sslInst) != 1 {
-		return nil, errors.New("Unable to configure SSL for I/O")
+	/* SNI must carry a host name, never an IP address */
+	ip := net.ParseIP(hostname)
+	if hostname != "" && ip == nil && SSL_set_tlsext_host_name(sslInst, hostname) != 1 {
+		SSL_free(sslInst)
+		return nil, errors.New("Unable to set SSL hostname")
 	}
 
-	ciphers := "HIGH:!aNULL:!kRSA:!PSK:!SRP:!MD5:!RC4"
-	if SSL_set_cipher_list(sslInst, ciphers) != 1 {
-		return nil, errors.New("Unable to configure ciphers")
-	}
+	/* Have the server staple an OCSP response for ConnectionState */
+	SSL_set_tlsext_status_type(sslInst, TLSEXT_STATUSTYPE_ocsp)
 
-	if SSL_set_tlsext_host_name(sslInst, hostname) != 1 {
-		return nil, errors.New("Unable to set SSL hostname")
+	if verify {
+		if err := setVerifyHost(sslInst, hostname, ip != nil); err != nil {
+			SSL_free(sslInst)
+			return nil, err
+		}
 	}
 
-	return conn, nil
+	return sslInst, nil
 }
 
-/* Make the connection */
-func connect(conn bio.BIO) error {
-	if bio.BIO_do_connect(conn) != 1 {
-		return errors.New("Unable to connect to SSL destination")
-	}
+// setVerifyHost makes the certificate chain check also match the peer
+// certificate against hostname, as described in RFC 6125.
+func setVerifyHost(sslInst SSL, hostname string, isIP bool) error {
+	param := SSL_get0_param(sslInst)
 
-	if bio.BIO_do_handshake(conn) != 1 {
-		return errors.New("Unable to complete SSL handshake")
+	if isIP {
+		if X509_VERIFY_PARAM_set1_ip_asc(param, hostname) != 1 {
+			return errors.New("Unable to set IP address for verification")
+		}
+		return nil
 	}
 
+	X509_VERIFY_PARAM_set_hostflags(param, uint(X509_CHECK_FLAG_NO_PARTIAL_WILDCARDS))
+	if X509_VERIFY_PARAM_set1_host(param, hostname, int64(len(hostname))) != 1 {
+		return errors.New("Unable to set hostname for verification")
+	}
 	return nil
 }
+
+/* Complete the handshake */
+func (h HTTPSConn) connect(hostname string, verify bool) error {
+	return h.engine.handshake(false, func(s SSL, err error) error {
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return err
+			}
+			if verify {
+				if verr := verifyError(s, hostname); verr != nil {
+					return verr
+				}
+			}
+			return err
+		}
+
+		if verify {
+			/* Anonymous suites are excluded, but never trust a missing certificate */
+			cert := SSL_get_peer_certificate(s)
+			if cert == nil {
+				return VerifyError{Host: hostname, Reason: "No certificate presented by peer"}
+			}
+			X509_free(cert)
+
+			return verifyError(s, hostname)
+		}
+
+		return nil
+	})
+}
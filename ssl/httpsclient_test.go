@@ -11,6 +11,7 @@ import (
 	// "net/url"
 	"net"
 	"strings"
+	"time"
 )
 
 var _ = Describe("Httpsclient", func() {
@@ -34,7 +35,7 @@ var _ = Describe("Httpsclient", func() {
 
 	Context("Using the golang http.Client", func() {
 		It("Should fetch a resource successfully", func() {
-			client := NewHTTPSClient()
+			client := NewHTTPSClient(nil)
 			urlPath := "https://" + host + resource
 			response, err := client.Get(urlPath)
 			Expect(err).To(BeNil())
@@ -60,7 +61,7 @@ var _ = Describe("Httpsclient", func() {
 			}, "\r\n")
 			dest = host + ":" + port
 
-			t = NewHTTPSTransport(nil)
+			t = NewHTTPSTransport(nil, nil)
 			Expect(t).NotTo(BeNil())
 			conn, err := t.Dial("tcp", dest)
 			Expect(err).NotTo(HaveOccurred())
@@ -127,6 +128,31 @@ var _ = Describe("Httpsclient", func() {
 			})
 		})
 
+		Context("Verifying the server certificate", func() {
+			It("Rejects a certificate that does not match the dialed address", func() {
+				addrs, err := net.LookupHost(host)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(len(addrs)).To(BeNumerically(">=", 1))
+
+				conn, err := t.Dial("tcp", net.JoinHostPort(addrs[0], port))
+				Expect(conn).To(BeNil())
+				Expect(err).To(BeAssignableToTypeOf(HostnameError{}))
+			})
+
+			It("Rejects a certificate from an untrusted issuer", func() {
+				conn, err := t.Dial("tcp", "localhost:8443")
+				Expect(conn).To(BeNil())
+				Expect(err).To(BeAssignableToTypeOf(VerifyError{}))
+				Expect(err.(VerifyError).UnknownIssuer()).To(BeTrue())
+			})
+
+			It("Accepts any certificate when verification is explicitly disabled", func() {
+				conn, err := NewInsecureHTTPSTransport(nil).Dial("tcp", "localhost:8443")
+				Expect(err).NotTo(HaveOccurred())
+				conn.Close()
+			})
+		})
+
 		Context("Connection management", func() {
 			It("Should not allow closing of an already closed connection", func() {
 				h.Close()
@@ -135,28 +161,52 @@ var _ = Describe("Httpsclient", func() {
 
 		})
 
-		// TODO: use these tests when Set[{Read,Write}]Deadline is implemented
-		// Context("Setting deadlines", func() {
-		// 	var now time.Time
-		// 	BeforeEach(func() {
-		// 		now = time.Now()
-		// 	})
-
-		// 	It("Should not allow setting a deadline equal or or before the current time", func() {
-		// 		bogus := now.Add(time.Duration(10) * time.Second * (-1))
-		// 		Expect(h.SetDeadLine(bogus)).NotTo(Succeed())
-		// 		Expect(h.SetReadDeadLine(bogus)).NotTo(Succeed())
-		// 		Expect(h.SetWriteDeadLine(bogus)).NotTo(Succeed())
-		// 	})
-
-		// 	It("Should not allow setting a deadline more than ten (10) minutes in the future", func() {
-		// 		bogus := now.Add(time.Duration(11) * time.Minute)
-		// 		Expect(h.SetDeadLine(bogus)).NotTo(Succeed())
-		// 		Expect(h.SetReadDeadLine(bogus)).NotTo(Succeed())
-		// 		Expect(h.SetWriteDeadLine(bogus)).NotTo(Succeed())
-		// 	})
-
-		// 	// TODO: Specs for checking that deadlines, having been set, are observed
-		// })
+		Context("Setting deadlines", func() {
+			AfterEach(func() {
+				h.Close()
+			})
+
+			It("Times out a read when the deadline passes", func() {
+				/* Nothing has been requested, so the server has nothing to send */
+				Expect(h.SetReadDeadline(time.Now().Add(100 * time.Millisecond))).To(Succeed())
+				rb := make([]byte, 50)
+				n, err := h.Read(rb)
+				Expect(n).To(Equal(0))
+				Expect(err).To(HaveOccurred())
+				ne, ok := err.(net.Error)
+				Expect(ok).To(BeTrue())
+				Expect(ne.Timeout()).To(BeTrue())
+			})
+
+			It("Fails immediately when the deadline has already passed", func() {
+				Expect(h.SetDeadline(time.Now().Add(-time.Second))).To(Succeed())
+				rb := make([]byte, 50)
+				_, err := h.Read(rb)
+				Expect(err).To(HaveOccurred())
+				Expect(err.(net.Error).Timeout()).To(BeTrue())
+			})
+
+			It("Reads normally once the deadline is cleared", func() {
+				Expect(h.SetDeadline(time.Now().Add(-time.Second))).To(Succeed())
+				Expect(h.SetDeadline(time.Time{})).To(Succeed())
+				wb := []byte(requestContent)
+				Expect(h.Write(wb)).To(Equal(len(wb)))
+				rb := make([]byte, 50)
+				Expect(h.Read(rb)).To(BeNumerically(">", 0))
+			})
+
+			It("Bounds the handshake with HandshakeTimeout", func() {
+				/* A listener which never answers the ClientHello */
+				l, err := net.Listen("tcp", "127.0.0.1:0")
+				Expect(err).NotTo(HaveOccurred())
+				defer l.Close()
+
+				cfg := &Config{HandshakeTimeout: 200 * time.Millisecond}
+				conn, err := NewHTTPSTransport(nil, cfg).Dial("tcp", l.Addr().String())
+				Expect(conn).To(BeNil())
+				Expect(err).To(HaveOccurred())
+				Expect(err.(net.Error).Timeout()).To(BeTrue())
+			})
+		})
 	})
 })
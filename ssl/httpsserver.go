@@ -2,13 +2,19 @@ package ssl
 
 import (
 	"bufio"
+	"context"
 	"errors"
-	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
 )
 
 /*
@@ -29,103 +35,168 @@ func HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)
 
 /*
 	Conn is used for incoming server connections.
+
+	The embedded net.Conn is the accepted connection. Its deadlines apply to
+	the handshake, reads and writes on the Conn.
 */
 type Conn struct {
 	net.Conn
 
-	ctx SSL
-	f   *os.File
-	fd  int
+	ctx    SSL
+	engine *engine
+
+	/* sslCtx is set when the Conn owns its SSL_CTX, as from NewServerConn */
+	sslCtx SSL_CTX
 }
 
 /*
-	Close will free any contexts, files, and connections that are
-	associated with the Conn.
+	newConn wraps the accepted connection c in a Conn using a new SSL object
+	from ctx.
 */
-func (c Conn) Close() error {
-	var e error
+func newConn(c net.Conn, ctx SSL_CTX) (Conn, error) {
+	s := SSL_new(ctx)
+	if s == nil {
+		return Conn{}, errors.New("Unable to initialize SSL")
+	}
 
-	SSL_free(c.ctx)
+	e, err := newEngine(c, s)
+	if err != nil {
+		SSL_free(s)
+		return Conn{}, err
+	}
 
-	if e = c.Conn.Close(); e != nil {
-		return e
+	return Conn{
+		Conn:   c,
+		ctx:    s,
+		engine: e,
+	}, nil
+}
+
+/*
+	NewServerConn returns a server-side TLS connection over conn, much like
+	crypto/tls.Server. cfg must name the server's key pair in CertFile and
+	KeyFile. The handshake runs on the first Read or Write, or when Handshake
+	is called.
+
+	A net.Listener that does the same for every connection is available from
+	NewListener.
+*/
+func NewServerConn(conn net.Conn, cfg *Config) (Conn, error) {
+	if cfg == nil || cfg.CertFile == "" || cfg.KeyFile == "" {
+		return Conn{}, errNoKeyPair
 	}
-	if e = c.f.Close(); e != nil {
-		return e
+
+	ctx, e := serverCtxInit(SSLv23_server_method(), cfg, cfg.CertFile, cfg.KeyFile)
+	if e != nil {
+		return Conn{}, e
+	}
+
+	/* A single connection has no use for rotation, but may resume tickets from a shared source */
+	if cfg.SessionTicketKeys != nil && !cfg.SessionTicketsDisabled {
+		keys, e := ticketKeysWire(cfg.SessionTicketKeys)
+		if e == nil {
+			e = setTicketKeys(ctx, keys)
+		}
+		if e != nil {
+			SSL_CTX_free(ctx)
+			return Conn{}, e
+		}
 	}
-	return nil
-}
 
-func (c Conn) getHandshake() error {
-	if SSL_accept(c.ctx) < 0 {
-		return errors.New("SSL handshake unsuccessful")
+	c, e := newConn(conn, ctx)
+	if e != nil {
+		SSL_CTX_free(ctx)
+		return Conn{}, e
 	}
+	c.sslCtx = ctx
 
-	return nil
+	return c, nil
 }
 
 /*
-	Read will use SSL_read to read directly from the file descriptor
-	of the open connection.
+	Close shuts TLS down, sending a close_notify alert and waiting for the
+	client's, for up to a second, so that each side can tell a complete
+	stream from a truncated one. It then frees any contexts and connections
+	that are associated with the Conn.
+
+	Close may be called from any goroutine, even during a Read or Write,
+	which then fail. Only the first call closes the Conn; later calls return
+	an error.
 */
-func (c Conn) Read(buf []byte) (int, error) {
-	result := SSL_read(c.ctx, buf, len(buf))
-	if result > 0 {
-		return result, nil
-	}
-	return 0, errors.New("Unable to read from connection.")
+func (c Conn) Close() error {
+	return c.close(true)
 }
 
 /*
-	Write will use SSL_write to write directly to the file descriptor
-	of the open connection.
+	CloseWrite sends a TLS close_notify alert, telling the client that no
+	more data follows. Writes fail from then on, while Read carries on until
+	the client's own close_notify, when it returns io.EOF. The underlying
+	connection stays open until Close.
 */
-func (c Conn) Write(buf []byte) (int, error) {
-	result := SSL_write(c.ctx, buf, len(buf))
-	if result > 0 {
-		return result, nil
-	}
-	return 0, errors.New("Unable to write to connection.")
+func (c Conn) CloseWrite() error {
+	return c.engine.closeWrite(false)
 }
 
-type response struct {
-	Conn
+/*
+	close releases the Conn, after a TLS shutdown if shutdown is true.
+*/
+func (c Conn) close(shutdown bool) error {
+	if !c.engine.beginClose() {
+		return errors.New("Attempted to close already closed Conn")
+	}
 
-	Headers http.Header
+	if shutdown {
+		c.engine.shutdown(closeNotifyTimeout)
+	}
+	c.engine.free()
+	if c.sslCtx != nil {
+		SSL_CTX_free(c.sslCtx)
+	}
 
-	req          *http.Request
-	sentStatus   bool
-	wroteHeaders bool
+	return c.Conn.Close()
 }
 
-func (r *response) Close() error {
-	if e := r.req.Body.Close(); e != nil {
-		return e
-	}
-	return r.Conn.Close()
+/*
+	closeNotify sends a TLS close_notify alert, giving up once
+	closeNotifyTimeout has passed. Unlike Close, it does not wait for the
+	client's.
+*/
+func (c Conn) closeNotify() error {
+	c.SetWriteDeadline(time.Now().Add(closeNotifyTimeout))
+	return c.engine.closeWrite(false)
 }
 
-func (r *response) Header() http.Header {
-	return r.Headers
+/*
+	Handshake runs the TLS handshake unless it has already run. Read and
+	Write call it as needed, so it only has to be called to bound the
+	handshake separately or to see its error early.
+	If the read or write deadline passes, the error is a net.Error with
+	Timeout() == true.
+*/
+func (c Conn) Handshake() error {
+	return c.engine.handshake(true, nil)
 }
 
-func (r *response) Write(buf []byte) (int, error) {
-	if !r.sentStatus {
-		r.WriteHeader(http.StatusOK)
-	}
-
-	if !r.wroteHeaders {
-		r.wroteHeaders = true
-		r.Headers.Write(r.Conn)
-		r.Write([]byte("\r\n"))
+/*
+	Read will use SSL_read to read from the open connection.
+	If the read deadline passes, the error is a net.Error with Timeout() == true.
+*/
+func (c Conn) Read(buf []byte) (int, error) {
+	if e := c.Handshake(); e != nil {
+		return 0, e
 	}
-
-	return r.Conn.Write(buf)
+	return c.engine.read(buf)
 }
 
-func (r *response) WriteHeader(s int) {
-	r.sentStatus = true
-	r.Conn.Write([]byte(fmt.Sprintf("HTTP/1.1 %d %s\r\n", s, http.StatusText(s))))
+/*
+	Write will use SSL_write to write to the open connection.
+	If the write deadline passes, the error is a net.Error with Timeout() == true.
+*/
+func (c Conn) Write(buf []byte) (int, error) {
+	if e := c.Handshake(); e != nil {
+		return 0, e
+	}
+	return c.engine.write(buf)
 }
 
 /*
@@ -137,12 +208,57 @@ type Server struct {
 	Handler  http.Handler
 	ErrorLog *log.Logger
 
-	ctx       SSL_CTX
-	listener  net.Listener
-	method    SSL_METHOD
-	keepalive bool
+	// ReadTimeout is the maximum duration for completing the handshake and
+	// reading the entire request. WriteTimeout is the maximum duration before
+	// timing out writes of the response. Zero means no timeout.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// ReadHeaderTimeout is the amount of time allowed to read request headers,
+	// counted from the first byte of the request. If zero, ReadTimeout is used.
+	ReadHeaderTimeout time.Duration
+
+	// IdleTimeout is the maximum amount of time to wait for the next request
+	// when keep-alives are enabled. If zero, ReadTimeout is used.
+	IdleTimeout time.Duration
+
+	// MaxConns limits the number of connections served at once. While the
+	// limit is reached, Serve stops accepting new connections. MaxHandshakes
+	// limits the number of TLS handshakes in progress at once, which bounds
+	// the CPU spent on them. Zero means no limit.
+	MaxConns      int
+	MaxHandshakes int
+
+	// TLSConfig optionally provides the TLS configuration. A nil TLSConfig
+	// selects the package defaults. To serve HTTP/2, list "h2" in
+	// TLSConfig.NextProtos.
+	TLSConfig *Config
+
+	// HTTP2 optionally configures the HTTP/2 server used for connections
+	// which negotiate "h2" through ALPN. A nil HTTP2 selects the defaults.
+	HTTP2 *http2.Server
+
+	listener          net.Listener
+	method            SSL_METHOD
+	disableKeepAlives int32
+	handshakes        chan struct{}
+
+	mu         sync.Mutex
+	conns      map[*trackedConn]struct{}
+	inShutdown bool
+	done       chan struct{}
+
+	/* Created along with the first HTTP/2 connection */
+	h2     *http2.Server
+	h2Base *http.Server
 }
 
+/*
+	ErrServerClosed is returned by Serve and ListenAndServeTLS once Shutdown
+	or Close has been called. It is the same value as http.ErrServerClosed.
+*/
+var ErrServerClosed = http.ErrServerClosed
+
 /*
 	ListenAndServeTLS will create a new Server and call ListenAndServeTLS
 	on the Server instance.
@@ -175,6 +291,7 @@ func (s *Server) ListenAndServe() error {
 
 	cf should be an absolute or relative path to the certificate file.
 	kf should be an absolute or relative path to the key file.
+	If both are empty, TLSConfig.CertFile and TLSConfig.KeyFile are used instead.
 */
 func (s *Server) ListenAndServeTLS(cf, kf string) error {
 	var (
@@ -193,6 +310,10 @@ func (s *Server) ListenAndServeTLS(cf, kf string) error {
 		s.ErrorLog = log.New(os.Stdout, "server: ", log.LstdFlags|log.Lshortfile)
 	}
 
+	if cf == "" && kf == "" && s.TLSConfig != nil {
+		cf, kf = s.TLSConfig.CertFile, s.TLSConfig.KeyFile
+	}
+
 	cf, e = filepath.Abs(cf)
 	if e != nil {
 		return e
@@ -203,105 +324,553 @@ func (s *Server) ListenAndServeTLS(cf, kf string) error {
 		return e
 	}
 
-	ctx, e := ctxInit("", s.method)
+	ctx, e := serverCtxInit(s.method, s.TLSConfig, cf, kf)
 	if e != nil {
 		return e
 	}
 
-	if SSL_CTX_use_certificate_file(ctx, cf, SSL_FILETYPE_PEM) <= 0 {
-		return errors.New("Could not use certificate file")
-	}
-
-	if SSL_CTX_use_PrivateKey_file(ctx, kf, SSL_FILETYPE_PEM) <= 0 {
-		return errors.New("Could not use key file")
-	}
-
-	if SSL_CTX_check_private_key(ctx) < 1 {
-		return errors.New("Private key does not match the public certificate")
-	}
-
 	l, e := net.Listen("tcp", s.Addr)
 	if e != nil {
+		SSL_CTX_free(ctx)
 		return e
 	}
 
-	s.ctx = ctx
+	tl, e := newListener(l, ctx, s.method, s.TLSConfig, cf, kf)
+	if e != nil {
+		l.Close()
+		return e
+	}
 
-	return s.Serve(l)
+	return s.Serve(tl)
 }
 
 /*
-	Serve will accept connections on the net.Listener provided. It will then call
-	Server.Handler.ServeHTTP on the resulting connection.
+	Serve will accept connections on the net.Listener provided. Each connection
+	is handled on its own goroutine, which will call Server.Handler.ServeHTTP
+	on the resulting connection.
+
+	l may come from NewListener or Listen. Any other listener is wrapped with
+	NewListener using TLSConfig, which must then name the key pair.
+
+	Each request's TLS field describes the connection it arrived on: the
+	protocol version, cipher suite, SNI name, ALPN protocol and the client's
+	certificates.
 
 	You should not close the connection in Server.Handler.ServeHTTP. The
 	connection will be automatically closed once Server.Handler.ServeHTTP
 	has finished.
+
+	Serve returns when Accept fails with an error that is not temporary.
+	After Shutdown or Close, the returned error is ErrServerClosed.
 */
 func (s *Server) Serve(l net.Listener) error {
 	var (
-		c net.Conn
-		e error
-		f *os.File
+		conns chan struct{}
+		delay time.Duration
 	)
 
-	check := func(e error) {
+	tl, ok := l.(*listener)
+	if !ok {
+		nl, e := NewListener(l, s.TLSConfig)
 		if e != nil {
-			s.ErrorLog.Printf("ERROR: %s\n", e)
+			l.Close()
+			return e
 		}
+		tl = nl.(*listener)
+	}
+	tl.setLogger(s.logf)
+	l = tl
+
+	s.mu.Lock()
+	if s.inShutdown {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
 	}
-
 	s.listener = l
+	done := s.doneChan()
+	s.mu.Unlock()
+
+	if s.MaxConns > 0 {
+		conns = make(chan struct{}, s.MaxConns)
+	}
+	if s.MaxHandshakes > 0 {
+		s.handshakes = make(chan struct{}, s.MaxHandshakes)
+	}
 
 	for {
-		c, e = s.listener.Accept()
-		check(e)
+		if conns != nil {
+			select {
+			case conns <- struct{}{}:
+			case <-done:
+				return ErrServerClosed
+			}
+		}
 
-		switch c.(type) {
-		case *net.IPConn:
-			f, e = c.(*net.IPConn).File()
-		case *net.TCPConn:
-			f, e = c.(*net.TCPConn).File()
-		case *net.UDPConn:
-			f, e = c.(*net.UDPConn).File()
-		case *net.UnixConn:
-			f, e = c.(*net.UnixConn).File()
+		c, e := l.Accept()
+		if e != nil {
+			if conns != nil {
+				<-conns
+			}
+
+			select {
+			case <-done:
+				return ErrServerClosed
+			default:
+			}
+
+			/* Back off on temporary errors such as running out of file descriptors */
+			if ne, ok := e.(net.Error); ok && ne.Temporary() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+				s.logf("Accept error: %s; retrying in %s", e, delay)
+				time.Sleep(delay)
+				continue
+			}
+			return e
 		}
+		delay = 0
+
+		go func() {
+			s.serve(c.(Conn))
+			if conns != nil {
+				<-conns
+			}
+		}()
+	}
+}
 
+/*
+	serve runs the handshake on the accepted connection c, then reads requests
+	and passes them to the handler for as long as the connection is kept alive.
+	Pipelined requests are answered in the order they arrive.
+*/
+func (s *Server) serve(oc Conn) {
+	check := func(e error) {
+		if e != nil {
+			s.logf("ERROR: %s", e)
+		}
+	}
+
+	tc := &trackedConn{Conn: oc, idle: true}
+	if !s.trackConn(tc, true) {
+		check(oc.Close())
+		return
+	}
+	hijacked := false
+	defer func() {
+		s.trackConn(tc, false)
+		if !hijacked {
+			check(tc.close(false))
+		}
+	}()
+
+	if s.ReadTimeout > 0 {
+		oc.SetReadDeadline(time.Now().Add(s.ReadTimeout))
+	}
+	if s.WriteTimeout > 0 {
+		oc.SetWriteDeadline(time.Now().Add(s.WriteTimeout))
+	}
+
+	if s.handshakes != nil {
+		s.handshakes <- struct{}{}
+	}
+	e := oc.Handshake()
+	if s.handshakes != nil {
+		<-s.handshakes
+	}
+	if e != nil {
 		check(e)
+		return
+	}
+
+	cs := oc.ConnectionState()
+	state := cs.tlsState()
+	if cs.NegotiatedProtocol == http2.NextProtoTLS {
+		s.serveHTTP2(tc, state)
+		return
+	}
 
-		c = Conn{
-			Conn: c,
-			ctx:  SSL_new(s.ctx),
-			f:    f,
-			fd:   int(f.Fd()),
+	buf := bufio.NewReader(oc)
+	for first := true; ; first = false {
+		if !first {
+			if d := s.idleTimeout(); d > 0 {
+				oc.SetReadDeadline(time.Now().Add(d))
+			} else {
+				oc.SetReadDeadline(time.Time{})
+			}
 		}
 
-		oc := c.(Conn)
-		SSL_set_fd(oc.ctx, oc.fd)
+		/* Wait for the first byte of the next request */
+		if _, e = buf.Peek(1); e != nil {
+			/* An idle client going away or timing out is not an error */
+			if !idleClose(e) && !tc.isClosed() {
+				check(e)
+			}
+			return
+		}
+		if !tc.setIdle(false) {
+			/* Closed by Shutdown while idle */
+			return
+		}
 
-		check(oc.getHandshake())
+		start := time.Now()
+		if d := s.readHeaderTimeout(); d > 0 {
+			oc.SetReadDeadline(start.Add(d))
+		}
 
-		buf := bufio.NewReader(oc)
 		req, e := http.ReadRequest(buf)
-		check(e)
-
-		res := &response{
-			Conn:    oc,
-			Headers: make(http.Header),
-			req:     req,
+		if e != nil {
+			check(e)
+			return
+		}
+		/* Each request gets its own copy, as with net/http */
+		ts := *state
+		req.TLS = &ts
+
+		if s.ReadTimeout > 0 {
+			oc.SetReadDeadline(start.Add(s.ReadTimeout))
+		} else {
+			oc.SetReadDeadline(time.Time{})
 		}
+		if s.WriteTimeout > 0 {
+			oc.SetWriteDeadline(time.Now().Add(s.WriteTimeout))
+		}
+
+		res := newResponse(s, oc, buf, req, s.keepAlivesEnabled() && !s.shuttingDown() && !req.Close)
 
 		s.Handler.ServeHTTP(res, req)
 
+		if res.hijacked {
+			hijacked = true
+			return
+		}
+
+		/* Tell the client not to reuse the connection if Shutdown began meanwhile */
+		if s.shuttingDown() {
+			res.keepAlive = false
+		}
+
+		/* The rest of the body must be consumed before the next request can be read */
+		if res.keepAlive {
+			switch {
+			case res.body.mustClose():
+				res.keepAlive = false
+			case res.body.drain(maxDrainBytes) != nil:
+				res.keepAlive = false
+			}
+		}
+
+		if e = res.finish(); e != nil {
+			check(e)
+			return
+		}
 		check(req.Body.Close())
 
-		check(oc.Close())
+		if !res.keepAlive {
+			/* Let the client tell a complete response from a truncated one */
+			check(tc.close(true))
+			return
+		}
+		if !tc.setIdle(true) {
+			return
+		}
+	}
+}
+
+/*
+	idleClose reports whether e, met while waiting for a request, only means
+	that the client went away or stayed idle too long, as is normal with
+	keep-alive.
+*/
+func idleClose(e error) bool {
+	if e == io.EOF || e == io.ErrUnexpectedEOF {
+		return true
+	}
+	ne, ok := e.(net.Error)
+	return ok && ne.Timeout()
+}
+
+/*
+	maxDrainBytes is the most unread request body that will be discarded in
+	order to keep a connection alive.
+*/
+const maxDrainBytes = 256 << 10
+
+func (s *Server) idleTimeout() time.Duration {
+	if s.IdleTimeout != 0 {
+		return s.IdleTimeout
+	}
+	return s.ReadTimeout
+}
+
+func (s *Server) readHeaderTimeout() time.Duration {
+	if s.ReadHeaderTimeout != 0 {
+		return s.ReadHeaderTimeout
+	}
+	return s.ReadTimeout
+}
+
+func (s *Server) keepAlivesEnabled() bool {
+	return atomic.LoadInt32(&s.disableKeepAlives) == 0
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inShutdown
+}
+
+/* doneChan must be called with s.mu held */
+func (s *Server) doneChan() chan struct{} {
+	if s.done == nil {
+		s.done = make(chan struct{})
+	}
+	return s.done
+}
+
+/*
+	trackConn adds or removes c from the connections closed by Shutdown and
+	Close. It reports false if c cannot be added because the server is
+	shutting down.
+*/
+func (s *Server) trackConn(c *trackedConn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !add {
+		delete(s.conns, c)
+		return true
+	}
+	if s.inShutdown {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[*trackedConn]struct{})
+	}
+	s.conns[c] = struct{}{}
+	return true
+}
+
+/*
+	beginShutdown stops Serve from accepting connections and closes the
+	listener.
+*/
+func (s *Server) beginShutdown() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.inShutdown {
+		s.inShutdown = true
+		close(s.doneChan())
+	}
+	if s.listener == nil {
+		return nil
 	}
+	l := s.listener
+	s.listener = nil
+	return l.Close()
+}
 
-	return nil
+/*
+	closeIdleConns closes the connections waiting for a request, and reports
+	whether there were no others.
+*/
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	quiescent := true
+	for c := range s.conns {
+		if !c.closeIfIdle() {
+			quiescent = false
+		}
+	}
+	return quiescent
 }
 
+/*
+	shutdownPollInterval is how often Shutdown looks for connections which
+	have become idle.
+*/
+const shutdownPollInterval = 100 * time.Millisecond
+
+/*
+	Shutdown gracefully shuts down the server. It closes the listener, then
+	closes idle connections with a TLS close_notify and waits for active
+	requests to finish. Connections are not kept alive once Shutdown has
+	been called, and HTTP/2 clients are sent GOAWAY. Closing the listener
+	releases its SSL_CTX, which OpenSSL frees along with the last
+	connection.
+
+	If ctx expires first, Shutdown returns ctx.Err(). Serve returns
+	ErrServerClosed immediately, so the program should wait for Shutdown to
+	return before exiting.
+
+	Hijacked connections are not tracked and must be closed by their owner.
+*/
+func (s *Server) Shutdown(ctx context.Context) error {
+	e := s.beginShutdown()
+	s.shutdownHTTP2()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() {
+			return e
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+/*
+	Close immediately closes the listener and all connections, including
+	those with requests in progress. Use Shutdown to let them finish.
+
+	Close returns any error from closing the listener.
+*/
+func (s *Server) Close() error {
+	e := s.beginShutdown()
+
+	s.mu.Lock()
+	for c := range s.conns {
+		c.close(false)
+	}
+	s.mu.Unlock()
+
+	return e
+}
+
+/*
+	ReloadCertificates rereads the server's key pairs from their files and
+	swaps them in atomically. New handshakes use the new certificates, while
+	connections already accepted keep the old ones. If the new files cannot
+	be loaded, for instance because the key does not match the certificate,
+	the error is returned and the server keeps the last good key pairs.
+
+	Setting TLSConfig.CertReloadInterval makes the server do this by itself
+	whenever the files change.
+*/
+func (s *Server) ReloadCertificates() error {
+	s.mu.Lock()
+	l, ok := s.listener.(*listener)
+	s.mu.Unlock()
+
+	if !ok {
+		return errors.New("Server is not serving")
+	}
+	return l.ReloadCertificates()
+}
+
+/*
+	RotateTicketKeys fetches new session ticket keys from
+	TLSConfig.SessionTicketKeys, or makes random ones, and puts them in use.
+	Tickets sealed with keys the source no longer returns are then refused.
+	If the keys cannot be fetched, the error is returned and the server keeps
+	the current ones.
+
+	The server does this by itself every TLSConfig.TicketKeyRotation.
+*/
+func (s *Server) RotateTicketKeys() error {
+	s.mu.Lock()
+	l, ok := s.listener.(*listener)
+	s.mu.Unlock()
+
+	if !ok {
+		return errors.New("Server is not serving")
+	}
+	return l.RotateTicketKeys()
+}
+
+/*
+	trackedConn records whether a connection is waiting for a request, so that
+	Shutdown can close it without interrupting a response.
+*/
+type trackedConn struct {
+	Conn
+
+	mu     sync.Mutex
+	idle   bool
+	closed bool
+}
+
+/* setIdle reports false if the connection has already been closed */
+func (c *trackedConn) setIdle(idle bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.idle = idle
+	return !c.closed
+}
+
+func (c *trackedConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+/* closeIfIdle closes the connection with a close_notify if it is idle */
+func (c *trackedConn) closeIfIdle() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return true
+	}
+	if !c.idle {
+		return false
+	}
+	c.closeLocked(true)
+	return true
+}
+
+/* Close sends a close_notify and closes the connection, as serve would, for the HTTP/2 server */
+func (c *trackedConn) Close() error {
+	return c.close(true)
+}
+
+/* close closes the connection unless that has already happened */
+func (c *trackedConn) close(notify bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	return c.closeLocked(notify)
+}
+
+func (c *trackedConn) closeLocked(notify bool) error {
+	c.closed = true
+	if notify {
+		c.closeNotify()
+	}
+	return c.Conn.close(false)
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+/*
+	SetKeepAlivesEnabled controls whether HTTP keep-alives are enabled.
+	By default, keep-alives are always enabled.
+*/
 func (s *Server) SetKeepAlivesEnabled(v bool) {
-	s.keepalive = v
+	if v {
+		atomic.StoreInt32(&s.disableKeepAlives, 0)
+	} else {
+		atomic.StoreInt32(&s.disableKeepAlives, 1)
+	}
 }
@@ -3,8 +3,17 @@ package ssl_test
 import (
 	. "github.com/IBM-Bluemix/golang-openssl-wrapper/ssl"
 
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/exec"
+	"sync"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -17,7 +26,7 @@ var _ = AfterSuite(cleanup)
 
 var _ = Describe("Httpsserver", func() {
 	It("Should get a valid response from the /aloha endpoint", func() {
-		client := NewHTTPSClient()
+		client := NewInsecureHTTPSClient()
 		url := "https://localhost:8443/aloha"
 		res, e := client.Get(url)
 		Expect(e).To(BeNil())
@@ -32,7 +41,7 @@ var _ = Describe("Httpsserver", func() {
 	})
 
 	It("Should get a valid response from the /server endpoint", func() {
-		client := NewHTTPSClient()
+		client := NewInsecureHTTPSClient()
 		url := "https://localhost:8443/server"
 		res, e := client.Get(url)
 		Expect(e).To(BeNil())
@@ -43,7 +52,7 @@ var _ = Describe("Httpsserver", func() {
 	})
 
 	It("Should get a valid response from the /mux endpoint", func() {
-		client := NewHTTPSClient()
+		client := NewInsecureHTTPSClient()
 		url := "https://localhost:8443/mux"
 		res, e := client.Get(url)
 		Expect(e).To(BeNil())
@@ -56,8 +65,395 @@ var _ = Describe("Httpsserver", func() {
 		Expect(string(body[:i])).To(Equal("Using gorilla/mux"))
 		Expect(res.Body.Close()).To(BeNil())
 	})
+
+	It("Should drop a client that stalls the handshake once ReadTimeout passes", func() {
+		stalled, e := net.Dial("tcp", "localhost:8443")
+		Expect(e).To(BeNil())
+		defer stalled.Close()
+
+		/* The server closes the connection rather than waiting forever */
+		stalled.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, e = stalled.Read(make([]byte, 1))
+		Expect(e).To(Equal(io.EOF))
+
+		client := NewInsecureHTTPSClient()
+		res, e := client.Get("https://localhost:8443/aloha")
+		Expect(e).To(BeNil())
+		Expect(res.Body.Close()).To(BeNil())
+	})
+})
+
+var _ = Describe("Httpsserver responses", func() {
+	var client http.Client
+
+	BeforeEach(func() {
+		client = NewInsecureHTTPSClient()
+	})
+
+	It("Should send Content-Length, Date and Content-Type for short responses", func() {
+		res, e := client.Get("https://localhost:8443/aloha")
+		Expect(e).To(BeNil())
+		defer res.Body.Close()
+
+		Expect(res.ContentLength).To(BeEquivalentTo(len("ALOHA!!")))
+		Expect(res.Header.Get("Date")).NotTo(BeEmpty())
+		Expect(res.Header.Get("Content-Type")).To(Equal("text/plain; charset=utf-8"))
+	})
+
+	It("Should send headers but no body for HEAD requests", func() {
+		res, e := client.Head("https://localhost:8443/aloha")
+		Expect(e).To(BeNil())
+		defer res.Body.Close()
+
+		Expect(res.ContentLength).To(BeEquivalentTo(len("ALOHA!!")))
+		body, e := ioutil.ReadAll(res.Body)
+		Expect(e).To(BeNil())
+		Expect(body).To(BeEmpty())
+	})
+
+	It("Should chunk responses larger than the buffer", func() {
+		res, e := client.Get("https://localhost:8443/large")
+		Expect(e).To(BeNil())
+		defer res.Body.Close()
+
+		Expect(res.TransferEncoding).To(Equal([]string{"chunked"}))
+		body, e := ioutil.ReadAll(res.Body)
+		Expect(e).To(BeNil())
+		Expect(len(body)).To(Equal(10000))
+	})
+
+	It("Should not send a body or length with 204 No Content", func() {
+		res, e := client.Get("https://localhost:8443/nocontent")
+		Expect(e).To(BeNil())
+		defer res.Body.Close()
+
+		Expect(res.StatusCode).To(Equal(http.StatusNoContent))
+		Expect(res.Header.Get("Content-Length")).To(BeEmpty())
+	})
+
+	It("Should stream flushed output as chunks", func() {
+		res, e := client.Get("https://localhost:8443/stream")
+		Expect(e).To(BeNil())
+		defer res.Body.Close()
+
+		Expect(res.TransferEncoding).To(Equal([]string{"chunked"}))
+		body, e := ioutil.ReadAll(res.Body)
+		Expect(e).To(BeNil())
+		Expect(string(body)).To(Equal("chunk0;chunk1;chunk2;"))
+	})
+
+	It("Should let the handler hijack the connection", func() {
+		res, e := client.Get("https://localhost:8443/hijack")
+		Expect(e).To(BeNil())
+		defer res.Body.Close()
+
+		body, e := ioutil.ReadAll(res.Body)
+		Expect(e).To(BeNil())
+		Expect(string(body)).To(Equal("hijacked"))
+	})
+})
+
+var _ = Describe("Httpsserver concurrency", func() {
+	It("Should serve other clients while one stalls the handshake", func() {
+		stalled, e := net.Dial("tcp", "localhost:8443")
+		Expect(e).To(BeNil())
+		defer stalled.Close()
+
+		start := time.Now()
+		client := NewInsecureHTTPSClient()
+		res, e := client.Get("https://localhost:8443/aloha")
+		Expect(e).To(BeNil())
+		Expect(res.Body.Close()).To(BeNil())
+
+		/* The stalled client is only dropped after the 1s ReadTimeout */
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+
+	Context("With a limit on concurrent connections", func() {
+		var s *Server
+
+		BeforeEach(func() {
+			s = &Server{
+				Addr:        "localhost:8444",
+				Handler:     http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) { res.Write([]byte("OK")) }),
+				ReadTimeout: 1 * time.Second,
+				MaxConns:    1,
+			}
+			go s.ListenAndServeTLS("tests/certs/server/server.pem", "tests/certs/server/server.key")
+			time.Sleep(500 * time.Millisecond)
+		})
+
+		AfterEach(func() {
+			s.Close()
+		})
+
+		It("Should hold new connections until a slot is free", func() {
+			stalled, e := net.Dial("tcp", "localhost:8444")
+			Expect(e).To(BeNil())
+			defer stalled.Close()
+			time.Sleep(100 * time.Millisecond)
+
+			start := time.Now()
+			client := NewInsecureHTTPSClient()
+			res, e := client.Get("https://localhost:8444/")
+			Expect(e).To(BeNil())
+			Expect(res.Body.Close()).To(BeNil())
+
+			/* Served only once the stalled connection timed out */
+			Expect(time.Since(start)).To(BeNumerically(">=", 800*time.Millisecond))
+		})
+	})
+})
+
+var _ = Describe("Httpsserver shutdown", func() {
+	var (
+		s      *Server
+		served chan error
+	)
+
+	BeforeEach(func() {
+		s = &Server{
+			Addr: "localhost:8445",
+			Handler: http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				if req.URL.Path == "/slow" {
+					time.Sleep(500 * time.Millisecond)
+				}
+				res.Write([]byte("OK"))
+			}),
+			ReadTimeout: 5 * time.Second,
+		}
+		served = make(chan error, 1)
+		go func() {
+			served <- s.ListenAndServeTLS("tests/certs/server/server.pem", "tests/certs/server/server.key")
+		}()
+		time.Sleep(500 * time.Millisecond)
+	})
+
+	AfterEach(func() {
+		s.Close()
+	})
+
+	It("Should make Serve return ErrServerClosed", func() {
+		Expect(s.Shutdown(context.Background())).To(BeNil())
+		Eventually(served).Should(Receive(Equal(ErrServerClosed)))
+
+		_, e := net.Dial("tcp", "localhost:8445")
+		Expect(e).NotTo(BeNil())
+	})
+
+	It("Should let in-flight requests finish", func() {
+		got := make(chan string, 1)
+		go func() {
+			defer GinkgoRecover()
+			client := NewInsecureHTTPSClient()
+			res, e := client.Get("https://localhost:8445/slow")
+			Expect(e).To(BeNil())
+			defer res.Body.Close()
+			body, e := ioutil.ReadAll(res.Body)
+			Expect(e).To(BeNil())
+			Expect(res.Close).To(BeTrue())
+			got <- string(body)
+		}()
+		time.Sleep(100 * time.Millisecond)
+
+		start := time.Now()
+		Expect(s.Shutdown(context.Background())).To(BeNil())
+		Expect(time.Since(start)).To(BeNumerically(">=", 300*time.Millisecond))
+		Eventually(got).Should(Receive(Equal("OK")))
+	})
+
+	It("Should close idle connections with a close_notify", func() {
+		conn, e := NewInsecureHTTPSTransport(nil).Dial("tcp", "localhost:8445")
+		Expect(e).To(BeNil())
+		defer conn.Close()
+
+		_, e = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		Expect(e).To(BeNil())
+		rd := bufio.NewReader(conn)
+		res, e := http.ReadResponse(rd, nil)
+		Expect(e).To(BeNil())
+		_, e = ioutil.ReadAll(res.Body)
+		Expect(e).To(BeNil())
+
+		start := time.Now()
+		Expect(s.Shutdown(context.Background())).To(BeNil())
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, e = rd.ReadByte()
+		Expect(e).To(Equal(io.EOF))
+	})
+
+	It("Should give up when the context expires", func() {
+		conn, e := NewInsecureHTTPSTransport(nil).Dial("tcp", "localhost:8445")
+		Expect(e).To(BeNil())
+		defer conn.Close()
+		_, e = conn.Write([]byte("GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		Expect(e).To(BeNil())
+		time.Sleep(100 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		Expect(s.Shutdown(ctx)).To(Equal(context.DeadlineExceeded))
+	})
+
+	It("Should drop active connections on Close", func() {
+		conn, e := NewInsecureHTTPSTransport(nil).Dial("tcp", "localhost:8445")
+		Expect(e).To(BeNil())
+		defer conn.Close()
+		_, e = conn.Write([]byte("GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		Expect(e).To(BeNil())
+		time.Sleep(100 * time.Millisecond)
+
+		Expect(s.Close()).To(BeNil())
+		Eventually(served).Should(Receive(Equal(ErrServerClosed)))
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, e = http.ReadResponse(bufio.NewReader(conn), nil)
+		Expect(e).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("Httpsserver keep-alive", func() {
+	var (
+		conn net.Conn
+		rd   *bufio.Reader
+	)
+
+	BeforeEach(func() {
+		var e error
+		conn, e = NewInsecureHTTPSTransport(nil).Dial("tcp", "localhost:8443")
+		Expect(e).To(BeNil())
+		rd = bufio.NewReader(conn)
+	})
+
+	AfterEach(func() {
+		conn.Close()
+	})
+
+	readAloha := func() *http.Response {
+		res, e := http.ReadResponse(rd, nil)
+		Expect(e).To(BeNil())
+		body, e := ioutil.ReadAll(res.Body)
+		Expect(e).To(BeNil())
+		Expect(string(body)).To(Equal("ALOHA!!"))
+		return res
+	}
+
+	It("Should answer several requests on one connection", func() {
+		for i := 0; i < 3; i++ {
+			_, e := conn.Write([]byte("GET /aloha HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+			Expect(e).To(BeNil())
+			res := readAloha()
+			Expect(res.Close).To(BeFalse())
+		}
+	})
+
+	It("Should answer pipelined requests in order", func() {
+		req := "GET /aloha HTTP/1.1\r\nHost: localhost\r\n\r\n"
+		_, e := conn.Write([]byte(req + req))
+		Expect(e).To(BeNil())
+		readAloha()
+		readAloha()
+	})
+
+	It("Should close the connection after Connection: close", func() {
+		_, e := conn.Write([]byte("GET /aloha HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+		Expect(e).To(BeNil())
+		res := readAloha()
+		Expect(res.Close).To(BeTrue())
+		_, e = rd.ReadByte()
+		Expect(e).To(Equal(io.EOF))
+	})
+
+	It("Should close HTTP/1.0 connections unless asked to keep them alive", func() {
+		_, e := conn.Write([]byte("GET /aloha HTTP/1.0\r\nConnection: keep-alive\r\n\r\n"))
+		Expect(e).To(BeNil())
+		res := readAloha()
+		Expect(res.Header.Get("Connection")).To(Equal("keep-alive"))
+
+		_, e = conn.Write([]byte("GET /aloha HTTP/1.0\r\n\r\n"))
+		Expect(e).To(BeNil())
+		res = readAloha()
+		Expect(res.Close).To(BeTrue())
+		_, e = rd.ReadByte()
+		Expect(e).To(Equal(io.EOF))
+	})
+
+	It("Should close an idle connection after the idle timeout", func() {
+		_, e := rd.ReadByte()
+		Expect(e).To(Equal(io.EOF))
+	})
+})
+
+var _ = Describe("Httpsserver error log", func() {
+	var (
+		s    *Server
+		logs *lockedBuffer
+	)
+
+	BeforeEach(func() {
+		logs = &lockedBuffer{}
+		s = &Server{
+			Addr:        "localhost:8457",
+			Handler:     http.NotFoundHandler(),
+			ErrorLog:    log.New(logs, "", 0),
+			ReadTimeout: 200 * time.Millisecond,
+		}
+		go s.ListenAndServeTLS("tests/certs/server/server.pem", "tests/certs/server/server.key")
+		time.Sleep(500 * time.Millisecond)
+	})
+
+	AfterEach(func() {
+		s.Close()
+	})
+
+	/* handshake returns a client connection which has sent no request */
+	handshake := func() (net.Conn, HTTPSConn) {
+		raw, e := net.Dial("tcp", "localhost:8457")
+		Expect(e).To(BeNil())
+		c, e := Client(raw, &Config{InsecureSkipVerify: true})
+		Expect(e).To(BeNil())
+		Expect(c.Handshake()).To(Succeed())
+		return raw, c
+	}
+
+	It("Should not log clients which go away or idle out without a request", func() {
+		/* With a close_notify */
+		_, c := handshake()
+		Expect(c.Close()).To(Succeed())
+
+		/* Without one */
+		raw, _ := handshake()
+		raw.Close()
+
+		/* Past the read timeout */
+		raw, _ = handshake()
+		defer raw.Close()
+
+		time.Sleep(500 * time.Millisecond)
+		Expect(logs.String()).To(BeEmpty())
+	})
 })
 
+/* lockedBuffer collects what a server logs from its own goroutines */
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
 func cleanup() {
 	c.Process.Kill()
 }
@@ -0,0 +1,303 @@
+package ssl
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// listener wraps the connections accepted by an inner net.Listener in
+// server-side Conns sharing one SSL_CTX.
+type listener struct {
+	net.Listener
+
+	/* mu keeps Accept from using ctx after Close or a reload has freed it */
+	mu   sync.Mutex
+	ctx  SSL_CTX
+	logf func(format string, args ...interface{})
+
+	/* What ctx is made from, so that it can be made again */
+	method SSL_METHOD
+	cfg    *Config
+	cf, kf string
+
+	/* tickets supplies the session ticket keys, last fetched as ticketKeys */
+	tickets    TicketKeySource
+	ticketKeys string
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+var errNoKeyPair = errors.New("A server requires a Config with CertFile and KeyFile")
+
+// NewListener returns a net.Listener whose connections are accepted from
+// inner and secured with TLS, much like crypto/tls.NewListener.  cfg must name
+// the server's key pair in CertFile and KeyFile.
+//
+// Each connection returned by Accept is a Conn which runs the handshake on
+// its first Read or Write, or when Handshake is called.  The listener can be
+// passed to Server.Serve, to a standard http.Server, or used for any other
+// protocol.
+//
+// The listener also has a ReloadCertificates method, as described for
+// Server.ReloadCertificates, and honors cfg.CertReloadInterval.  Unless
+// cfg.SessionTicketsDisabled is set, it rotates its session ticket keys every
+// cfg.TicketKeyRotation.
+func NewListener(inner net.Listener, cfg *Config) (net.Listener, error) {
+	if cfg == nil || cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errNoKeyPair
+	}
+
+	method := SSLv23_server_method()
+	ctx, err := serverCtxInit(method, cfg, cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return newListener(inner, ctx, method, cfg, cfg.CertFile, cfg.KeyFile)
+}
+
+// Listen announces on the local network address and returns a listener as
+// described in NewListener.  network must be a stream oriented network such
+// as "tcp" or "unix".
+func Listen(network, addr string, cfg *Config) (net.Listener, error) {
+	if cfg == nil || cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errNoKeyPair
+	}
+
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	tl, err := NewListener(l, cfg)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return tl, nil
+}
+
+// newListener wraps inner, taking ownership of ctx, which was made by
+// serverCtxInit from method, cfg, cf and kf.  If the session ticket keys
+// cannot be fetched, ctx is freed and the error returned.
+func newListener(inner net.Listener, ctx SSL_CTX, method SSL_METHOD, cfg *Config, cf, kf string) (*listener, error) {
+	l := &listener{
+		Listener: inner,
+		ctx:      ctx,
+		logf:     log.Printf,
+		method:   method,
+		cfg:      cfg,
+		cf:       cf,
+		kf:       kf,
+		tickets:  ticketKeySource(cfg),
+		done:     make(chan struct{}),
+	}
+
+	if l.tickets != nil {
+		if err := l.RotateTicketKeys(); err != nil {
+			SSL_CTX_free(ctx)
+			return nil, err
+		}
+		go l.rotate(ticketKeyRotation(cfg))
+	}
+
+	if cfg != nil && cfg.CertReloadInterval > 0 {
+		go l.watch(cfg.CertReloadInterval)
+	}
+
+	return l, nil
+}
+
+// Accept waits for the next connection and returns it as a Conn.  The
+// handshake has not run yet.  A connection which cannot be set up for TLS is
+// closed and logged, and Accept waits for the next one; only a failure of the
+// listener itself is returned.
+func (l *listener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		l.mu.Lock()
+		if l.ctx == nil {
+			l.mu.Unlock()
+			c.Close()
+			return nil, errors.New("Use of closed listener")
+		}
+		oc, err := newConn(c, l.ctx)
+		logf := l.logf
+		l.mu.Unlock()
+
+		if err != nil {
+			c.Close()
+			logf("Dropping connection from %s: %s", c.RemoteAddr(), err)
+			continue
+		}
+		return oc, nil
+	}
+}
+
+// Close stops listening and releases the SSL_CTX.  Connections already
+// accepted hold their own reference to it and remain usable.
+func (l *listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+
+	l.mu.Lock()
+	if l.ctx != nil {
+		SSL_CTX_free(l.ctx)
+		l.ctx = nil
+	}
+	l.mu.Unlock()
+
+	return l.Listener.Close()
+}
+
+// ReloadCertificates rereads the key pairs and swaps them in for new
+// connections.  If they cannot be loaded, the error is returned and the
+// current ones stay in use.
+func (l *listener) ReloadCertificates() error {
+	ctx, err := serverCtxInit(l.method, l.cfg, l.cf, l.kf)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	if l.ctx == nil {
+		l.mu.Unlock()
+		SSL_CTX_free(ctx)
+		return errors.New("Use of closed listener")
+	}
+	if l.ticketKeys != "" {
+		/* Tickets sealed before the reload stay valid */
+		if err := setTicketKeys(ctx, l.ticketKeys); err != nil {
+			l.mu.Unlock()
+			SSL_CTX_free(ctx)
+			return err
+		}
+	}
+	old := l.ctx
+	l.ctx = ctx
+	l.mu.Unlock()
+
+	/* Connections made from old hold their own reference to it */
+	SSL_CTX_free(old)
+	return nil
+}
+
+// RotateTicketKeys fetches new session ticket keys from the listener's
+// source and puts them in use.  If they cannot be fetched, the error is
+// returned and the current ones stay in use.
+func (l *listener) RotateTicketKeys() error {
+	if l.tickets == nil {
+		return errors.New("Session tickets are disabled")
+	}
+
+	keys, err := ticketKeysWire(l.tickets)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.ctx == nil {
+		return errors.New("Use of closed listener")
+	}
+	if err := setTicketKeys(l.ctx, keys); err != nil {
+		return err
+	}
+	l.ticketKeys = keys
+	return nil
+}
+
+// setLogger makes reload errors found while watching go to logf.
+func (l *listener) setLogger(logf func(format string, args ...interface{})) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logf = logf
+}
+
+// watch reloads the key pairs whenever their files change, checking every
+// interval until the listener is closed.
+func (l *listener) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	stamp := l.stamp()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+		}
+
+		/* A failed reload is not retried until the files change again */
+		s := l.stamp()
+		if s == stamp {
+			continue
+		}
+		stamp = s
+
+		if err := l.ReloadCertificates(); err != nil {
+			l.mu.Lock()
+			logf := l.logf
+			l.mu.Unlock()
+			logf("Keeping the current certificates: %s", err)
+		}
+	}
+}
+
+// rotate rotates the session ticket keys every interval until the listener
+// is closed.
+func (l *listener) rotate(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+		}
+
+		if err := l.RotateTicketKeys(); err != nil {
+			l.mu.Lock()
+			logf := l.logf
+			l.mu.Unlock()
+			logf("Keeping the current session ticket keys: %s", err)
+		}
+	}
+}
+
+// stamp summarizes the size and modification time of every key pair file.
+func (l *listener) stamp() string {
+	files := []string{l.cf, l.kf}
+	if l.cfg != nil {
+		for _, kp := range l.cfg.Certificates {
+			files = append(files, kp.CertFile, kp.KeyFile)
+		}
+	}
+	sort.Strings(files)
+
+	var b strings.Builder
+	for _, f := range files {
+		if fi, err := os.Stat(f); err == nil {
+			fmt.Fprintf(&b, "%s %d %d\n", f, fi.Size(), fi.ModTime().UnixNano())
+		} else {
+			fmt.Fprintf(&b, "%s -\n", f)
+		}
+	}
+	return b.String()
+}
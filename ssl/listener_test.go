@@ -0,0 +1,263 @@
+package ssl_test
+
+import (
+	. "github.com/IBM-Bluemix/golang-openssl-wrapper/ssl"
+
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Listener", func() {
+	var (
+		cfg *Config
+		l   net.Listener
+	)
+
+	BeforeEach(func() {
+		cfg = &Config{
+			CertFile: "tests/certs/server/server.pem",
+			KeyFile:  "tests/certs/server/server.key",
+		}
+
+		var e error
+		l, e = Listen("tcp", "localhost:8446", cfg)
+		Expect(e).To(BeNil())
+	})
+
+	AfterEach(func() {
+		l.Close()
+	})
+
+	It("Requires a key pair", func() {
+		_, e := Listen("tcp", "localhost:8447", nil)
+		Expect(e).NotTo(BeNil())
+
+		_, e = Listen("tcp", "localhost:8447", &Config{CertFile: "tests/certs/server/server.pem"})
+		Expect(e).NotTo(BeNil())
+	})
+
+	It("Accepts connections before the handshake", func() {
+		accepted := make(chan net.Conn, 1)
+		go func() {
+			c, e := l.Accept()
+			if e == nil {
+				accepted <- c
+			}
+		}()
+
+		raw, e := net.Dial("tcp", "localhost:8446")
+		Expect(e).To(BeNil())
+		defer raw.Close()
+
+		var c net.Conn
+		Eventually(accepted).Should(Receive(&c))
+		defer c.Close()
+
+		c.SetDeadline(time.Now().Add(200 * time.Millisecond))
+		Expect(c.(Conn).Handshake()).NotTo(BeNil())
+	})
+
+	It("Carries an arbitrary protocol", func() {
+		go func() {
+			defer GinkgoRecover()
+			c, e := l.Accept()
+			Expect(e).To(BeNil())
+			defer c.Close()
+
+			line, e := bufio.NewReader(c).ReadString('\n')
+			Expect(e).To(BeNil())
+			_, e = c.Write([]byte("echo: " + line))
+			Expect(e).To(BeNil())
+		}()
+
+		conn, e := NewInsecureHTTPSTransport(nil).Dial("tcp", "localhost:8446")
+		Expect(e).To(BeNil())
+		defer conn.Close()
+
+		_, e = conn.Write([]byte("hello\n"))
+		Expect(e).To(BeNil())
+		line, e := bufio.NewReader(conn).ReadString('\n')
+		Expect(e).To(BeNil())
+		Expect(line).To(Equal("echo: hello\n"))
+	})
+
+	It("Works with the standard http.Server", func() {
+		s := &http.Server{
+			Handler: http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				res.Write([]byte("standard"))
+			}),
+		}
+		go s.Serve(l)
+		defer s.Close()
+
+		client := NewInsecureHTTPSClient()
+		res, e := client.Get("https://localhost:8446/")
+		Expect(e).To(BeNil())
+		defer res.Body.Close()
+
+		body, e := ioutil.ReadAll(res.Body)
+		Expect(e).To(BeNil())
+		Expect(string(body)).To(Equal("standard"))
+	})
+
+	It("Can be passed to Server.Serve", func() {
+		s := &Server{
+			Handler: http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				res.Write([]byte("ssl"))
+			}),
+		}
+		go s.Serve(l)
+		defer s.Close()
+
+		client := NewInsecureHTTPSClient()
+		res, e := client.Get("https://localhost:8446/")
+		Expect(e).To(BeNil())
+		defer res.Body.Close()
+
+		body, e := ioutil.ReadAll(res.Body)
+		Expect(e).To(BeNil())
+		Expect(string(body)).To(Equal("ssl"))
+	})
+})
+
+var _ = Describe("Certificate reloading", func() {
+	const (
+		aCert    = "tests/certs/sni/a.test.pem"
+		aKey     = "tests/certs/sni/a.test.key"
+		wildCert = "tests/certs/sni/wild.test.pem"
+		wildKey  = "tests/certs/sni/wild.test.key"
+	)
+
+	type reloader interface {
+		ReloadCertificates() error
+	}
+
+	var (
+		dir string
+		cfg *Config
+		l   net.Listener
+	)
+
+	/* install copies a key pair to where the listener loads it from */
+	install := func(cert, key string) {
+		for src, dst := range map[string]string{cert: cfg.CertFile, key: cfg.KeyFile} {
+			b, e := ioutil.ReadFile(src)
+			Expect(e).To(BeNil())
+			Expect(ioutil.WriteFile(dst, b, 0600)).To(Succeed())
+		}
+	}
+
+	/* presented returns the common name of the certificate a new connection sees */
+	presented := func() string {
+		raw, e := net.Dial("tcp", "localhost:8450")
+		Expect(e).To(BeNil())
+
+		c, e := Client(raw, &Config{InsecureSkipVerify: true})
+		Expect(e).To(BeNil())
+		defer c.Close()
+
+		Expect(c.Handshake()).To(BeNil())
+		return c.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+
+	BeforeEach(func() {
+		var e error
+		dir, e = ioutil.TempDir("", "ssl-reload")
+		Expect(e).To(BeNil())
+
+		cfg = &Config{
+			CertFile: filepath.Join(dir, "cert.pem"),
+			KeyFile:  filepath.Join(dir, "key.pem"),
+		}
+		install(aCert, aKey)
+	})
+
+	JustBeforeEach(func() {
+		var e error
+		l, e = Listen("tcp", "localhost:8450", cfg)
+		Expect(e).To(BeNil())
+
+		go func() {
+			for {
+				c, e := l.Accept()
+				if e != nil {
+					return
+				}
+				go func() {
+					c.(Conn).Handshake()
+					ioutil.ReadAll(c)
+					c.Close()
+				}()
+			}
+		}()
+	})
+
+	AfterEach(func() {
+		l.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("Swaps in new certificates for new connections only", func() {
+		raw, e := net.Dial("tcp", "localhost:8450")
+		Expect(e).To(BeNil())
+		old, e := Client(raw, &Config{InsecureSkipVerify: true})
+		Expect(e).To(BeNil())
+		defer old.Close()
+		Expect(old.Handshake()).To(BeNil())
+
+		install(wildCert, wildKey)
+		Expect(l.(reloader).ReloadCertificates()).To(Succeed())
+		Expect(presented()).To(Equal("*.wild.test"))
+
+		/* The connection made before keeps working with the old certificate */
+		_, e = old.Write([]byte("still here\n"))
+		Expect(e).To(BeNil())
+		Expect(old.ConnectionState().PeerCertificates[0].Subject.CommonName).To(Equal("a.test"))
+	})
+
+	It("Keeps the last good certificates when the new ones are bad", func() {
+		install(aCert, wildKey)
+		e := l.(reloader).ReloadCertificates()
+		Expect(e).To(HaveOccurred())
+		Expect(e.Error()).To(ContainSubstring("Private key does not match"))
+
+		Expect(presented()).To(Equal("a.test"))
+	})
+
+	Context("With CertReloadInterval", func() {
+		BeforeEach(func() {
+			cfg.CertReloadInterval = 20 * time.Millisecond
+		})
+
+		It("Reloads certificates when their files change", func() {
+			Expect(presented()).To(Equal("a.test"))
+
+			/* Make sure the modification time moves even on coarse file systems */
+			install(wildCert, wildKey)
+			later := time.Now().Add(time.Second)
+			Expect(os.Chtimes(cfg.CertFile, later, later)).To(Succeed())
+
+			Eventually(presented).Should(Equal("*.wild.test"))
+		})
+	})
+
+	It("Is available through Server.ReloadCertificates", func() {
+		s := &Server{Handler: http.NotFoundHandler()}
+		Expect(s.ReloadCertificates()).NotTo(Succeed())
+
+		sl, e := Listen("tcp", "localhost:8451", cfg)
+		Expect(e).To(BeNil())
+		go s.Serve(sl)
+		defer s.Close()
+
+		Eventually(s.ReloadCertificates).Should(Succeed())
+	})
+})
@@ -0,0 +1,415 @@
+package ssl
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+	bufferBeforeChunking is the amount of output held back before the headers
+	are sent. A handler which writes less than this and returns is answered
+	with a Content-Length; otherwise the body is chunked.
+*/
+const bufferBeforeChunking = 4096
+
+/*
+	response implements http.ResponseWriter, http.Flusher, http.Hijacker and
+	http.CloseNotifier for ssl.Server, following the framing rules used by
+	net/http.
+*/
+type response struct {
+	srv  *Server
+	conn Conn
+	req  *http.Request
+	br   *bufio.Reader
+	w    *bufio.Writer
+
+	/* handlerHeader is what the handler sees; header is the snapshot taken by WriteHeader */
+	handlerHeader http.Header
+	header        http.Header
+	status        int
+	wroteHeader   bool
+	sentHeader    bool
+
+	buf           bytes.Buffer
+	chunking      bool
+	cw            io.WriteCloser
+	contentLength int64
+	written       int64
+
+	keepAlive bool
+	hijacked  bool
+
+	body        *requestBody
+	closeOnce   sync.Once
+	closeNotify chan bool
+	watchDone   chan struct{}
+	finished    chan struct{}
+}
+
+func newResponse(s *Server, c Conn, br *bufio.Reader, req *http.Request, keepAlive bool) *response {
+	r := &response{
+		srv:           s,
+		conn:          c,
+		req:           req,
+		br:            br,
+		w:             bufio.NewWriter(c),
+		handlerHeader: make(http.Header),
+		contentLength: -1,
+		keepAlive:     keepAlive,
+		finished:      make(chan struct{}),
+	}
+
+	r.body = &requestBody{
+		ReadCloser: req.Body,
+		eof:        make(chan struct{}),
+	}
+	if req.ProtoAtLeast(1, 1) && req.Header.Get("Expect") == "100-continue" && req.ContentLength != 0 {
+		r.body.expectContinue = r
+	}
+	req.Body = r.body
+
+	return r
+}
+
+func (r *response) Header() http.Header {
+	return r.handlerHeader
+}
+
+func (r *response) WriteHeader(code int) {
+	if r.hijacked {
+		r.srv.logf("WriteHeader called on hijacked connection")
+		return
+	}
+	if r.wroteHeader {
+		r.srv.logf("Superfluous WriteHeader call")
+		return
+	}
+
+	r.wroteHeader = true
+	r.status = code
+	r.header = cloneHeader(r.handlerHeader)
+
+	if cl := r.header.Get("Content-Length"); cl != "" {
+		if n, e := strconv.ParseInt(cl, 10, 64); e == nil && n >= 0 {
+			r.contentLength = n
+		} else {
+			r.srv.logf("Invalid Content-Length %q", cl)
+			r.header.Del("Content-Length")
+		}
+	}
+}
+
+func (r *response) Write(buf []byte) (int, error) {
+	if r.hijacked {
+		return 0, http.ErrHijacked
+	}
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	if !bodyAllowed(r.status) {
+		return 0, http.ErrBodyNotAllowed
+	}
+
+	r.written += int64(len(buf))
+	if r.contentLength >= 0 && r.req.Method != "HEAD" && r.written > r.contentLength {
+		return 0, http.ErrContentLength
+	}
+
+	if !r.sentHeader {
+		r.buf.Write(buf)
+		if r.buf.Len() >= bufferBeforeChunking {
+			if e := r.sendHeader(false); e != nil {
+				return 0, e
+			}
+		}
+		return len(buf), nil
+	}
+
+	return r.writeBody(buf)
+}
+
+/*
+	Flush sends any buffered output to the client, starting a chunked
+	response if the length of the body is not yet known.
+*/
+func (r *response) Flush() {
+	if r.hijacked {
+		return
+	}
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	if !r.sentHeader {
+		r.sendHeader(false)
+	}
+	r.w.Flush()
+}
+
+/*
+	Hijack lets the handler take over the connection, e.g. for WebSockets.
+	The server will no longer write to, read from or close the connection.
+*/
+func (r *response) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if r.hijacked {
+		return nil, nil, http.ErrHijacked
+	}
+
+	if r.wroteHeader && !r.sentHeader {
+		r.sendHeader(false)
+	}
+	if e := r.w.Flush(); e != nil {
+		return nil, nil, e
+	}
+
+	r.waitWatch()
+	r.hijacked = true
+
+	return r.conn, bufio.NewReadWriter(r.br, bufio.NewWriter(r.conn)), nil
+}
+
+/*
+	CloseNotify returns a channel which receives true if the client goes away
+	before the response is finished. The connection is only watched once the
+	request body has been read.
+*/
+func (r *response) CloseNotify() <-chan bool {
+	r.closeOnce.Do(func() {
+		r.closeNotify = make(chan bool, 1)
+		r.watchDone = make(chan struct{})
+		go r.watch()
+	})
+	return r.closeNotify
+}
+
+/* watch waits for the request body to be consumed, then for the client to go away */
+func (r *response) watch() {
+	defer close(r.watchDone)
+
+	select {
+	case <-r.body.eof:
+	case <-r.finished:
+		return
+	}
+
+	if _, e := r.br.Peek(1); e != nil {
+		if ne, ok := e.(net.Error); ok && ne.Timeout() {
+			return
+		}
+		r.closeNotify <- true
+	}
+}
+
+/* waitWatch stops using the connection reader until the watcher is done with it */
+func (r *response) waitWatch() {
+	select {
+	case <-r.finished:
+	default:
+		close(r.finished)
+	}
+	if r.watchDone != nil {
+		/* Interrupt the watcher's pending read */
+		r.conn.SetReadDeadline(aLongTimeAgo)
+		<-r.watchDone
+		r.conn.SetReadDeadline(time.Time{})
+	}
+}
+
+/* aLongTimeAgo is a deadline which has always passed */
+var aLongTimeAgo = time.Unix(1, 0)
+
+/*
+	sendHeader writes the status line and headers to the connection, followed
+	by any buffered body. final is true once the handler has returned, at which
+	point the length of the body is known.
+*/
+func (r *response) sendHeader(final bool) error {
+	h := r.header
+	r.sentHeader = true
+
+	if h.Get("Date") == "" {
+		h.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+
+	hasTE := h.Get("Transfer-Encoding") != ""
+	if bodyAllowed(r.status) && h.Get("Content-Type") == "" && !hasTE && r.buf.Len() > 0 {
+		h.Set("Content-Type", http.DetectContentType(r.buf.Bytes()))
+	}
+
+	switch {
+	case !bodyAllowed(r.status):
+		h.Del("Transfer-Encoding")
+		if r.status != http.StatusNotModified {
+			h.Del("Content-Length")
+		}
+	case r.contentLength >= 0:
+		h.Del("Transfer-Encoding")
+	case final && (r.req.Method != "HEAD" || r.buf.Len() > 0):
+		r.contentLength = int64(r.buf.Len())
+		h.Set("Content-Length", strconv.FormatInt(r.contentLength, 10))
+	case r.req.Method == "HEAD":
+		/* Nothing to frame */
+	case r.req.ProtoAtLeast(1, 1):
+		h.Del("Content-Length")
+		h.Set("Transfer-Encoding", "chunked")
+		r.chunking = true
+		r.cw = httputil.NewChunkedWriter(r.w)
+	default:
+		/* An HTTP/1.0 body of unknown length ends when the connection does */
+		h.Del("Transfer-Encoding")
+		r.keepAlive = false
+	}
+
+	if h.Get("Connection") == "close" {
+		r.keepAlive = false
+	}
+	switch {
+	case !r.keepAlive:
+		h.Set("Connection", "close")
+	case r.req.ProtoAtLeast(1, 1):
+		h.Del("Connection")
+	default:
+		/* HTTP/1.0 clients only keep the connection if we say so */
+		h.Set("Connection", "keep-alive")
+	}
+
+	fmt.Fprintf(r.w, "HTTP/1.1 %d %s\r\n", r.status, http.StatusText(r.status))
+	h.Write(r.w)
+	r.w.WriteString("\r\n")
+
+	if r.buf.Len() > 0 {
+		_, e := r.writeBody(r.buf.Bytes())
+		r.buf.Reset()
+		return e
+	}
+	return nil
+}
+
+func (r *response) writeBody(buf []byte) (int, error) {
+	if r.req.Method == "HEAD" || !bodyAllowed(r.status) {
+		return len(buf), nil
+	}
+	if r.chunking {
+		return r.cw.Write(buf)
+	}
+	return r.w.Write(buf)
+}
+
+/*
+	finish completes the response once the handler has returned.
+*/
+func (r *response) finish() error {
+	r.waitWatch()
+
+	if r.hijacked {
+		return nil
+	}
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	if !r.sentHeader {
+		if e := r.sendHeader(true); e != nil {
+			return e
+		}
+	}
+
+	if r.chunking {
+		r.cw.Close()
+		r.w.WriteString("\r\n")
+	}
+
+	/* A short body leaves the client waiting for bytes which will never come */
+	if r.contentLength >= 0 && r.req.Method != "HEAD" && bodyAllowed(r.status) && r.written != r.contentLength {
+		r.keepAlive = false
+	}
+
+	return r.w.Flush()
+}
+
+/*
+	requestBody wraps the request body to note when it has been read to the
+	end, and to send "100 Continue" when the handler first reads it.
+*/
+type requestBody struct {
+	io.ReadCloser
+
+	eof            chan struct{}
+	eofOnce        sync.Once
+	expectContinue *response
+	sentContinue   bool
+}
+
+func (b *requestBody) Read(p []byte) (int, error) {
+	if r := b.expectContinue; r != nil && !b.sentContinue {
+		b.sentContinue = true
+		/* Once the final response has started, the client no longer waits for this */
+		if !r.sentHeader {
+			r.w.WriteString("HTTP/1.1 100 Continue\r\n\r\n")
+			if e := r.w.Flush(); e != nil {
+				return 0, e
+			}
+		}
+	}
+
+	n, e := b.ReadCloser.Read(p)
+	if e == io.EOF {
+		b.eofOnce.Do(func() {
+			close(b.eof)
+		})
+	}
+	return n, e
+}
+
+/*
+	mustClose reports whether the client was never told to send the body it
+	announced, in which case the connection cannot be reused.
+*/
+func (b *requestBody) mustClose() bool {
+	return b.expectContinue != nil && !b.sentContinue
+}
+
+var errBodyTooLarge = errors.New("Unread request body too large to discard")
+
+/*
+	drain discards up to max bytes of unread body so that the next request on
+	the connection can be read.
+*/
+func (b *requestBody) drain(max int64) error {
+	n, e := io.CopyN(ioutil.Discard, b, max+1)
+	if e == io.EOF {
+		return nil
+	}
+	if e == nil && n > max {
+		return errBodyTooLarge
+	}
+	return e
+}
+
+/* bodyAllowed reports whether a response with the given status may have a body */
+func bodyAllowed(status int) bool {
+	if status >= 100 && status <= 199 {
+		return false
+	}
+	return status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+func cloneHeader(h http.Header) http.Header {
+	c := make(http.Header, len(h))
+	for k, v := range h {
+		c[k] = append([]string(nil), v...)
+	}
+	return c
+}
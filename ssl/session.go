@@ -0,0 +1,190 @@
+package ssl
+
+import (
+	"container/list"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultSessionCacheSize is the capacity of a ClientSessionCache created
+// with a capacity of zero.
+const DefaultSessionCacheSize = 64
+
+// ClientSessionCache keeps the TLS sessions handed out by servers, including
+// TLS 1.3 tickets, so that later connections to the same server resume them
+// and skip most of the handshake. As in crypto/tls, sessions are kept under
+// Config.ServerName and the port, or the server's address when no name is
+// set, and are only offered to connections made with the same name. Set it
+// in Config.ClientSessionCache. It is safe for concurrent use and may be
+// shared by several Configs.
+//
+// Sessions hold memory inside OpenSSL; Flush releases them.
+type ClientSessionCache struct {
+	capacity int
+	lifetime time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	hits    uint64
+	misses  uint64
+}
+
+// sessionEntry is the latest session for one key, and the server name it was
+// handed out under.
+type sessionEntry struct {
+	key        string
+	serverName string
+	session    SSL_SESSION
+	expires    time.Time
+}
+
+// ClientSessionCacheStats counts the lookups made in a ClientSessionCache.
+// A hit means the connection offered a session for resumption; the server
+// may still decline it, which ConnectionState.DidResume shows.
+type ClientSessionCacheStats struct {
+	Hits     uint64
+	Misses   uint64
+	Sessions int
+}
+
+// NewClientSessionCache returns a ClientSessionCache holding sessions for up
+// to capacity servers, evicting the least recently used beyond that.
+// Zero selects DefaultSessionCacheSize.  Sessions are kept no longer than
+// lifetime, or than the server allows if that is shorter.  Zero leaves the
+// lifetime to the server.
+func NewClientSessionCache(capacity int, lifetime time.Duration) *ClientSessionCache {
+	if capacity <= 0 {
+		capacity = DefaultSessionCacheSize
+	}
+
+	return &ClientSessionCache{
+		capacity: capacity,
+		lifetime: lifetime,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Stats returns the number of lookups which found a session and which did
+// not, and the number of sessions held.
+func (c *ClientSessionCache) Stats() ClientSessionCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return ClientSessionCacheStats{
+		Hits:     c.hits,
+		Misses:   c.misses,
+		Sessions: c.lru.Len(),
+	}
+}
+
+// Flush releases every session in the cache.
+func (c *ClientSessionCache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for c.lru.Len() > 0 {
+		c.removeLocked(c.lru.Back())
+	}
+}
+
+// get returns a new reference to the session for key, or nil if there is
+// none or it was handed out under a server name other than serverName.  The
+// caller must release it with SSL_SESSION_free.
+func (c *ClientSessionCache) get(key, serverName string) SSL_SESSION {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if ok && time.Now().After(elem.Value.(*sessionEntry).expires) {
+		c.removeLocked(elem)
+		ok = false
+	}
+	if ok && elem.Value.(*sessionEntry).serverName != serverName {
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		return nil
+	}
+
+	c.hits++
+	c.lru.MoveToFront(elem)
+	session := elem.Value.(*sessionEntry).session
+	SSL_SESSION_up_ref(session)
+	return session
+}
+
+// put makes session, handed out under serverName, the one for key, taking
+// over the caller's reference.  Sessions which cannot be resumed are released
+// instead.
+func (c *ClientSessionCache) put(key, serverName string, session SSL_SESSION) {
+	if SSL_SESSION_is_resumable(session) != 1 {
+		SSL_SESSION_free(session)
+		return
+	}
+
+	/* The server's timeout counts from when it issued the session */
+	start := time.Unix(SSL_SESSION_get_time(session), 0)
+	expires := start.Add(time.Duration(SSL_SESSION_get_timeout(session)) * time.Second)
+	if c.lifetime > 0 && time.Now().Add(c.lifetime).Before(expires) {
+		expires = time.Now().Add(c.lifetime)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.removeLocked(elem)
+	}
+	c.entries[key] = c.lru.PushFront(&sessionEntry{
+		key:        key,
+		serverName: serverName,
+		session:    session,
+		expires:    expires,
+	})
+
+	for c.lru.Len() > c.capacity {
+		c.removeLocked(c.lru.Back())
+	}
+}
+
+func (c *ClientSessionCache) removeLocked(elem *list.Element) {
+	e := c.lru.Remove(elem).(*sessionEntry)
+	delete(c.entries, e.key)
+	SSL_SESSION_free(e.session)
+}
+
+// sessionCacheKey returns the key sessions from the server at addr are kept
+// under: serverName and the port of addr, or addr itself if serverName is
+// empty.
+func sessionCacheKey(serverName, addr string) string {
+	if serverName == "" {
+		return addr
+	}
+	if _, port, err := net.SplitHostPort(addr); err == nil {
+		return net.JoinHostPort(serverName, port)
+	}
+	return serverName
+}
+
+// useSessionCache makes the connection to addr, made with serverName, offer
+// the session cached for them, and keeps the sessions the server hands out in
+// cache.  It must be called before the handshake.
+func (h HTTPSConn) useSessionCache(cache *ClientSessionCache, serverName, addr string) {
+	key := sessionCacheKey(serverName, addr)
+	if session := cache.get(key, serverName); session != nil {
+		h.engine.inspect(func(s SSL) {
+			SSL_set_session(s, session)
+		})
+		SSL_SESSION_free(session)
+	}
+
+	h.engine.sessions = func(s SSL) {
+		if session := SSL_get1_session(s); session.Swigcptr() != 0 {
+			cache.put(key, serverName, session)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package ssl_test
+
+import (
+	. "github.com/IBM-Bluemix/golang-openssl-wrapper/ssl"
+
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client sessions", func() {
+	var (
+		cache     *ClientSessionCache
+		listeners []net.Listener
+	)
+
+	/* serve greets every connection to addr, over one shared server context */
+	serve := func(addr string) {
+		l, e := Listen("tcp", addr, &Config{
+			CertFile: "tests/certs/server/server.pem",
+			KeyFile:  "tests/certs/server/server.key",
+		})
+		Expect(e).To(BeNil())
+		listeners = append(listeners, l)
+
+		go func() {
+			for {
+				c, e := l.Accept()
+				if e != nil {
+					return
+				}
+				go func() {
+					c.Write([]byte("hello\n"))
+					c.Close()
+				}()
+			}
+		}()
+	}
+
+	/*
+	 * resumedAs connects to addr, sending serverName, and reports whether the
+	 * session was resumed
+	 */
+	resumedAs := func(addr, serverName string, maxVersion int) bool {
+		raw, e := net.Dial("tcp", addr)
+		Expect(e).To(BeNil())
+
+		c, e := Client(raw, &Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: true,
+			MaxVersion:         maxVersion,
+			ClientSessionCache: cache,
+		})
+		Expect(e).To(BeNil())
+		defer c.Close()
+
+		/* TLS 1.3 tickets arrive ahead of the greeting */
+		line, e := bufio.NewReader(c).ReadString('\n')
+		Expect(e).To(BeNil())
+		Expect(line).To(Equal("hello\n"))
+
+		return c.ConnectionState().DidResume
+	}
+
+	resumed := func(addr string, maxVersion int) bool {
+		return resumedAs(addr, "", maxVersion)
+	}
+
+	BeforeEach(func() {
+		cache = NewClientSessionCache(0, 0)
+		listeners = nil
+		serve("localhost:8453")
+	})
+
+	AfterEach(func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+		cache.Flush()
+	})
+
+	It("Resumes TLS 1.3 sessions", func() {
+		Expect(resumed("localhost:8453", 0)).To(BeFalse())
+		Expect(resumed("localhost:8453", 0)).To(BeTrue())
+		Expect(cache.Stats()).To(Equal(ClientSessionCacheStats{Hits: 1, Misses: 1, Sessions: 1}))
+	})
+
+	It("Resumes TLS 1.2 sessions", func() {
+		Expect(resumed("localhost:8453", TLS1_2_VERSION)).To(BeFalse())
+		Expect(resumed("localhost:8453", TLS1_2_VERSION)).To(BeTrue())
+	})
+
+	It("Keeps one session per address", func() {
+		serve("localhost:8454")
+
+		Expect(resumed("localhost:8453", 0)).To(BeFalse())
+		Expect(resumed("localhost:8454", 0)).To(BeFalse())
+		Expect(resumed("localhost:8453", 0)).To(BeTrue())
+		Expect(cache.Stats().Sessions).To(Equal(2))
+	})
+
+	It("Offers sessions only to the server name they were handed out under", func() {
+		Expect(resumedAs("localhost:8453", "a.example.com", 0)).To(BeFalse())
+		Expect(resumedAs("localhost:8453", "b.example.com", 0)).To(BeFalse())
+		Expect(resumed("localhost:8453", 0)).To(BeFalse())
+		Expect(resumedAs("localhost:8453", "a.example.com", 0)).To(BeTrue())
+		Expect(cache.Stats().Sessions).To(Equal(3))
+	})
+
+	It("Evicts the least recently used session", func() {
+		cache = NewClientSessionCache(1, 0)
+		serve("localhost:8454")
+
+		Expect(resumed("localhost:8453", 0)).To(BeFalse())
+		Expect(resumed("localhost:8454", 0)).To(BeFalse())
+		Expect(resumed("localhost:8453", 0)).To(BeFalse())
+		Expect(cache.Stats()).To(Equal(ClientSessionCacheStats{Hits: 0, Misses: 3, Sessions: 1}))
+	})
+
+	It("Drops sessions past their lifetime", func() {
+		cache = NewClientSessionCache(0, 10*time.Millisecond)
+
+		Expect(resumed("localhost:8453", 0)).To(BeFalse())
+		time.Sleep(20 * time.Millisecond)
+		Expect(resumed("localhost:8453", 0)).To(BeFalse())
+		Expect(cache.Stats().Misses).To(Equal(uint64(2)))
+	})
+
+	It("Forgets every session on Flush", func() {
+		Expect(resumed("localhost:8453", 0)).To(BeFalse())
+		cache.Flush()
+		Expect(cache.Stats().Sessions).To(BeZero())
+		Expect(resumed("localhost:8453", 0)).To(BeFalse())
+	})
+
+	It("Resumes sessions across the requests of an HTTPS client", func() {
+		s := &Server{
+			Handler: http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				fmt.Fprint(res, req.TLS.DidResume)
+			}),
+		}
+		l, e := Listen("tcp", "localhost:8455", &Config{
+			CertFile: "tests/certs/server/server.pem",
+			KeyFile:  "tests/certs/server/server.key",
+		})
+		Expect(e).To(BeNil())
+		go s.Serve(l)
+		defer s.Close()
+
+		c := NewHTTPSClient(&Config{InsecureSkipVerify: true, ClientSessionCache: cache})
+		get := func() string {
+			req, e := http.NewRequest("GET", "https://localhost:8455/", nil)
+			Expect(e).To(BeNil())
+
+			/* Each request gets a connection of its own */
+			req.Close = true
+			res, e := c.Do(req)
+			Expect(e).To(BeNil())
+			defer res.Body.Close()
+
+			body, e := ioutil.ReadAll(res.Body)
+			Expect(e).To(BeNil())
+			return string(body)
+		}
+
+		Expect(get()).To(Equal("false"))
+		Expect(get()).To(Equal("true"))
+	})
+})
@@ -0,0 +1,248 @@
+package ssl
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+
+	"github.com/IBM-Bluemix/golang-openssl-wrapper/crypto"
+)
+
+// peerCertificates returns the certificates sent by the peer of s, leaf
+// first.  It must be called with the engine's mu held.
+func peerCertificates(s SSL) []*x509.Certificate {
+	return peerChain(s, false)
+}
+
+// verifiedChains returns the chain OpenSSL built from the peer's leaf to a
+// trusted root, or nil if the peer's certificate was not verified.  It must
+// be called with the engine's mu held.
+func verifiedChains(s SSL) [][]*x509.Certificate {
+	if SSL_get_verify_result(s) != X509_V_OK {
+		return nil
+	}
+
+	chain := peerChain(s, true)
+	if len(chain) == 0 {
+		return nil
+	}
+	return [][]*x509.Certificate{chain}
+}
+
+// peerChain converts the peer's chain, or the verified one, to Go
+// certificates.
+func peerChain(s SSL, verified bool) []*x509.Certificate {
+	v := 0
+	if verified {
+		v = 1
+	}
+
+	var chain []*x509.Certificate
+	der := make([]byte, 4096)
+	for i := 0; ; i++ {
+		n := SSL_get_peer_cert_der(s, v, i, der, len(der))
+		if n > len(der) {
+			der = make([]byte, n)
+			n = SSL_get_peer_cert_der(s, v, i, der, len(der))
+		}
+		if n <= 0 {
+			return chain
+		}
+
+		/* ParseCertificate keeps the slice, so give it its own copy */
+		cert, err := x509.ParseCertificate(append([]byte(nil), der[:n]...))
+		if err != nil {
+			return chain
+		}
+		chain = append(chain, cert)
+	}
+}
+
+// ConnectionState records what was negotiated on a TLS connection, much like
+// crypto/tls.ConnectionState.
+type ConnectionState struct {
+	Version           uint16 // TLS1_VERSION ... TLS1_3_VERSION
+	HandshakeComplete bool
+	DidResume         bool // the session was resumed from an earlier connection
+
+	// CipherSuite is the IANA ID of the cipher suite, as in crypto/tls, and
+	// CipherSuiteName OpenSSL's name for it, as used in Config.CipherList.
+	CipherSuite     uint16
+	CipherSuiteName string
+
+	NegotiatedProtocol string // agreed on through ALPN
+	ServerName         string // sent by the client in SNI
+
+	// PeerCertificates is the chain sent by the peer, leaf first, and
+	// VerifiedChains the chain built from it to a trusted root.  On a server,
+	// they are empty unless Config.ClientAuth asks for a certificate.
+	PeerCertificates []*x509.Certificate
+	VerifiedChains   [][]*x509.Certificate
+
+	// OCSPResponse is the OCSP response stapled by the server, if any.
+	OCSPResponse []byte
+
+	// TLSUnique is the tls-unique channel binding of RFC 5929.  It is nil for
+	// TLS 1.3, which defines none; use ExportKeyingMaterial instead.
+	TLSUnique []byte
+
+	ekm func(label string, context []byte, length int) ([]byte, error)
+}
+
+// ExportKeyingMaterial returns length bytes of keying material derived from
+// the connection's master secret, as described in RFC 5705.  A nil context
+// is not the same as an empty one.  The connection must still be open.
+func (cs ConnectionState) ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error) {
+	if cs.ekm == nil {
+		return nil, errors.New("Keying material is only available after the handshake")
+	}
+	return cs.ekm(label, context, length)
+}
+
+// connectionState describes the connection once the handshake has succeeded,
+// waiting for a handshake in progress.
+func (e *engine) connectionState() ConnectionState {
+	e.hsMu.Lock()
+	defer e.hsMu.Unlock()
+
+	var cs ConnectionState
+	if !e.hsDone || e.hsErr != nil {
+		return cs
+	}
+
+	e.inspect(func(s SSL) {
+		cs = ConnectionState{
+			Version:            uint16(SSL_version(s)),
+			HandshakeComplete:  true,
+			DidResume:          SSL_session_reused(s) == 1,
+			CipherSuite:        uint16(SSL_get_cipher_suite(s)),
+			CipherSuiteName:    SSL_get_cipher_suite_name(s),
+			NegotiatedProtocol: alpnSelected(s),
+			ServerName:         SSL_get_servername(s, TLSEXT_NAMETYPE_host_name),
+			PeerCertificates:   peerCertificates(s),
+			VerifiedChains:     verifiedChains(s),
+			OCSPResponse:       ocspResponse(s),
+			TLSUnique:          tlsUnique(s),
+			ekm:                e.exportKeyingMaterial,
+		}
+	})
+	return cs
+}
+
+// exportKeyingMaterial implements ConnectionState.ExportKeyingMaterial.
+func (e *engine) exportKeyingMaterial(label string, context []byte, length int) ([]byte, error) {
+	err := errClosed
+	out := make([]byte, length)
+	e.inspect(func(s SSL) {
+		err = crypto.WithErrorQueue(func() error {
+			useContext := 0
+			if context != nil {
+				useContext = 1
+			}
+			if SSL_export_keying_material_buf(s, out, len(out), label, len(label), string(context), len(context), useContext) != 1 {
+				return crypto.NewOpenSSLError("Unable to export keying material")
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// tlsState converts cs for http.Request.TLS.
+func (cs ConnectionState) tlsState() *tls.ConnectionState {
+	return &tls.ConnectionState{
+		Version:            cs.Version,
+		HandshakeComplete:  cs.HandshakeComplete,
+		DidResume:          cs.DidResume,
+		CipherSuite:        cs.CipherSuite,
+		NegotiatedProtocol: cs.NegotiatedProtocol,
+		ServerName:         cs.ServerName,
+		PeerCertificates:   cs.PeerCertificates,
+		VerifiedChains:     cs.VerifiedChains,
+		OCSPResponse:       cs.OCSPResponse,
+		TLSUnique:          cs.TLSUnique,
+	}
+}
+
+// ocspResponse returns the OCSP response stapled by the server, if any.
+func ocspResponse(s SSL) []byte {
+	resp := make([]byte, 4096)
+	n := SSL_get_ocsp_response(s, resp, len(resp))
+	if n > len(resp) {
+		resp = make([]byte, n)
+		n = SSL_get_ocsp_response(s, resp, len(resp))
+	}
+	if n <= 0 || n > len(resp) {
+		return nil
+	}
+	return resp[:n]
+}
+
+// tlsUnique returns the first Finished message of the handshake, which is
+// the tls-unique channel binding, or nil for TLS 1.3.
+func tlsUnique(s SSL) []byte {
+	if SSL_version(s) >= TLS1_3_VERSION {
+		return nil
+	}
+
+	/* The client's Finished comes first, unless the session was resumed */
+	finished := SSL_get_finished
+	if (SSL_is_server(s) == 1) != (SSL_session_reused(s) == 1) {
+		finished = SSL_get_peer_finished
+	}
+
+	/* Finished messages are 12 bytes for TLS, at most 64 for any suite */
+	buf := make([]byte, 64)
+	n := finished(s, buf[:len(buf):len(buf)], int64(len(buf)))
+	if n <= 0 || n > int64(len(buf)) {
+		return nil
+	}
+	return buf[:n]
+}
+
+// ConnectionState returns details of the connection once the handshake has
+// completed; before that, HandshakeComplete is false.
+func (c Conn) ConnectionState() ConnectionState {
+	return c.engine.connectionState()
+}
+
+// ConnectionState returns details of the connection once the handshake has
+// completed; before that, HandshakeComplete is false.
+func (h HTTPSConn) ConnectionState() ConnectionState {
+	return h.engine.connectionState()
+}
+
+// PeerCertificates returns the certificate chain sent by the client, leaf
+// first, once the handshake has completed.  It is empty unless the server's
+// Config asks for a client certificate.
+func (c Conn) PeerCertificates() []*x509.Certificate {
+	var certs []*x509.Certificate
+	c.engine.inspect(func(s SSL) {
+		certs = peerCertificates(s)
+	})
+	return certs
+}
+
+// VerifiedChains returns the chains which verified the client's certificate
+// against the client CAs, once the handshake has completed.  It is empty if
+// the client sent no certificate or if that certificate did not verify, which
+// RequestClientCert and RequireAnyClientCert allow.
+func (c Conn) VerifiedChains() [][]*x509.Certificate {
+	var chains [][]*x509.Certificate
+	c.engine.inspect(func(s SSL) {
+		chains = verifiedChains(s)
+	})
+	return chains
+}
+
+// alpnSelected returns the application protocol agreed on through ALPN, or
+// an empty string.
+func alpnSelected(s SSL) string {
+	/* Protocol names are at most 255 bytes */
+	proto := make([]byte, 255)
+	n := SSL_get_alpn_selected(s, proto, len(proto))
+	return string(proto[:n])
+}
@@ -0,0 +1,369 @@
+package ssl_test
+
+import (
+	. "github.com/IBM-Bluemix/golang-openssl-wrapper/ssl"
+
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client certificates", func() {
+	const (
+		caFile     = "tests/certs/mtls/ca.pem"
+		clientCert = "tests/certs/mtls/client.pem"
+		clientKey  = "tests/certs/mtls/client.key"
+
+		/* Issued by a CA the server does not trust */
+		otherCert = "tests/certs/client/client.pem"
+		otherKey  = "tests/certs/client/client.key"
+	)
+
+	type result struct {
+		peers  []*x509.Certificate
+		chains [][]*x509.Certificate
+		err    error
+	}
+
+	var (
+		client, server net.Conn
+		serverCfg      *Config
+	)
+
+	BeforeEach(func() {
+		client, server = net.Pipe()
+		serverCfg = &Config{
+			CertFile:     "tests/certs/server/server.pem",
+			KeyFile:      "tests/certs/server/server.key",
+			ClientCAFile: caFile,
+		}
+	})
+
+	AfterEach(func() {
+		client.Close()
+		server.Close()
+	})
+
+	/* serve greets the client once the handshake succeeds, and reports what it saw */
+	serve := func() chan result {
+		done := make(chan result, 1)
+		go func() {
+			c, e := NewServerConn(server, serverCfg)
+			if e != nil {
+				done <- result{err: e}
+				return
+			}
+			defer c.Close()
+
+			if e = c.Handshake(); e == nil {
+				_, e = c.Write([]byte("welcome\n"))
+			}
+			done <- result{c.PeerCertificates(), c.VerifiedChains(), e}
+		}()
+		return done
+	}
+
+	/* greeting connects with the given key pair and reads the server's greeting */
+	greeting := func(cert, key string) error {
+		c, e := Client(client, &Config{InsecureSkipVerify: true, CertFile: cert, KeyFile: key})
+		Expect(e).To(BeNil())
+		defer c.Close()
+
+		line, e := bufio.NewReader(c).ReadString('\n')
+		if e == nil {
+			Expect(line).To(Equal("welcome\n"))
+		}
+		return e
+	}
+
+	It("Verifies a required client certificate", func() {
+		serverCfg.ClientAuth = RequireAndVerifyClientCert
+		done := serve()
+
+		Expect(greeting(clientCert, clientKey)).To(BeNil())
+
+		var r result
+		Eventually(done).Should(Receive(&r))
+		Expect(r.err).To(BeNil())
+		Expect(r.peers).To(HaveLen(1))
+		Expect(r.peers[0].Subject.CommonName).To(Equal("client.test"))
+		Expect(r.chains).To(HaveLen(1))
+		Expect(r.chains[0]).To(HaveLen(2))
+		Expect(r.chains[0][1].Subject.CommonName).To(Equal("Test Client CA"))
+	})
+
+	It("Rejects a client without a certificate when one is required", func() {
+		serverCfg.ClientAuth = RequireAndVerifyClientCert
+		done := serve()
+
+		Expect(greeting("", "")).NotTo(BeNil())
+
+		var r result
+		Eventually(done).Should(Receive(&r))
+		Expect(r.err).To(BeAssignableToTypeOf(Error{}))
+	})
+
+	It("Rejects a client certificate from an untrusted CA", func() {
+		serverCfg.ClientAuth = VerifyClientCertIfGiven
+		done := serve()
+
+		Expect(greeting(otherCert, otherKey)).NotTo(BeNil())
+
+		var r result
+		Eventually(done).Should(Receive(&r))
+		Expect(r.err).To(HaveOccurred())
+	})
+
+	It("Lets a client without a certificate through when none is required", func() {
+		serverCfg.ClientAuth = VerifyClientCertIfGiven
+		done := serve()
+
+		Expect(greeting("", "")).To(BeNil())
+
+		var r result
+		Eventually(done).Should(Receive(&r))
+		Expect(r.err).To(BeNil())
+		Expect(r.peers).To(BeEmpty())
+		Expect(r.chains).To(BeEmpty())
+	})
+
+	It("Accepts any client certificate with RequireAnyClientCert", func() {
+		serverCfg.ClientAuth = RequireAnyClientCert
+		done := serve()
+
+		Expect(greeting(otherCert, otherKey)).To(BeNil())
+
+		var r result
+		Eventually(done).Should(Receive(&r))
+		Expect(r.err).To(BeNil())
+		Expect(r.peers).To(HaveLen(1))
+		Expect(r.peers[0].Subject.CommonName).To(Equal("bluemix.net"))
+		Expect(r.chains).To(BeEmpty())
+	})
+
+	It("Still requires some certificate with RequireAnyClientCert", func() {
+		serverCfg.ClientAuth = RequireAnyClientCert
+		done := serve()
+
+		Expect(greeting("", "")).NotTo(BeNil())
+
+		var r result
+		Eventually(done).Should(Receive(&r))
+		Expect(r.err).To(HaveOccurred())
+	})
+
+	It("Only asks with RequestClientCert", func() {
+		serverCfg.ClientAuth = RequestClientCert
+		done := serve()
+
+		Expect(greeting("", "")).To(BeNil())
+
+		var r result
+		Eventually(done).Should(Receive(&r))
+		Expect(r.err).To(BeNil())
+		Expect(r.peers).To(BeEmpty())
+	})
+
+	It("Shows handlers the client's certificates", func() {
+		serverCfg.ClientAuth = RequireAndVerifyClientCert
+		l, e := Listen("tcp", "localhost:8448", serverCfg)
+		Expect(e).To(BeNil())
+
+		s := &Server{
+			Handler: http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				fmt.Fprintf(res, "%s %d", req.TLS.PeerCertificates[0].Subject.CommonName, len(req.TLS.VerifiedChains))
+			}),
+		}
+		go s.Serve(l)
+		defer s.Close()
+
+		c := NewHTTPSClient(&Config{InsecureSkipVerify: true, CertFile: clientCert, KeyFile: clientKey})
+		res, e := c.Get("https://localhost:8448/")
+		Expect(e).To(BeNil())
+		defer res.Body.Close()
+
+		body, e := ioutil.ReadAll(res.Body)
+		Expect(e).To(BeNil())
+		Expect(string(body)).To(Equal("client.test 1"))
+	})
+})
+
+var _ = Describe("Request TLS state", func() {
+	var (
+		cfg   *Config
+		s     *Server
+		state chan *tls.ConnectionState
+	)
+
+	BeforeEach(func() {
+		cfg = &Config{
+			CertFile: "tests/certs/server/server.pem",
+			KeyFile:  "tests/certs/server/server.key",
+		}
+		state = make(chan *tls.ConnectionState, 1)
+		s = &Server{
+			Handler: http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				state <- req.TLS
+			}),
+		}
+	})
+
+	AfterEach(func() {
+		s.Close()
+	})
+
+	/* get serves one request with cfg and returns its TLS state */
+	get := func(client *Config) *tls.ConnectionState {
+		l, e := Listen("tcp", "localhost:8449", cfg)
+		Expect(e).To(BeNil())
+		go s.Serve(l)
+
+		c := NewHTTPSClient(client)
+		res, e := c.Get("https://localhost:8449/")
+		Expect(e).To(BeNil())
+		res.Body.Close()
+
+		var ts *tls.ConnectionState
+		Eventually(state).Should(Receive(&ts))
+		return ts
+	}
+
+	It("Describes a TLS 1.3 connection", func() {
+		ts := get(&Config{InsecureSkipVerify: true})
+		Expect(ts).NotTo(BeNil())
+		Expect(ts.HandshakeComplete).To(BeTrue())
+		Expect(ts.Version).To(Equal(uint16(tls.VersionTLS13)))
+		Expect(tls.CipherSuiteName(ts.CipherSuite)).To(HavePrefix("TLS_"))
+		Expect(ts.ServerName).To(Equal("localhost"))
+		Expect(ts.DidResume).To(BeFalse())
+		Expect(ts.NegotiatedProtocol).To(BeEmpty())
+		Expect(ts.PeerCertificates).To(BeEmpty())
+	})
+
+	It("Describes a TLS 1.2 connection", func() {
+		cfg.MaxVersion = TLS1_2_VERSION
+		cfg.CipherList = "ECDHE-RSA-AES128-GCM-SHA256"
+
+		ts := get(&Config{InsecureSkipVerify: true})
+		Expect(ts.Version).To(Equal(uint16(tls.VersionTLS12)))
+		Expect(ts.CipherSuite).To(Equal(tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256))
+	})
+})
+
+var _ = Describe("ConnectionState", func() {
+	var (
+		client, server net.Conn
+		serverCfg      *Config
+		clientCfg      *Config
+	)
+
+	BeforeEach(func() {
+		client, server = net.Pipe()
+		serverCfg = &Config{
+			CertFile: "tests/certs/server/server.pem",
+			KeyFile:  "tests/certs/server/server.key",
+		}
+		clientCfg = &Config{ServerName: "example.test", InsecureSkipVerify: true}
+	})
+
+	AfterEach(func() {
+		client.Close()
+		server.Close()
+	})
+
+	/* handshake connects both ends of the pipe */
+	handshake := func() (HTTPSConn, Conn) {
+		accepted := make(chan Conn, 1)
+		go func() {
+			defer GinkgoRecover()
+			c, e := NewServerConn(server, serverCfg)
+			Expect(e).To(BeNil())
+			Expect(c.Handshake()).To(BeNil())
+			accepted <- c
+		}()
+
+		c, e := Client(client, clientCfg)
+		Expect(e).To(BeNil())
+		Expect(c.ConnectionState().HandshakeComplete).To(BeFalse())
+		Expect(c.Handshake()).To(BeNil())
+
+		var sc Conn
+		Eventually(accepted).Should(Receive(&sc))
+		return c, sc
+	}
+
+	It("Describes both ends of a TLS 1.3 connection", func() {
+		c, sc := handshake()
+		defer c.Close()
+		defer sc.Close()
+
+		cs, ss := c.ConnectionState(), sc.ConnectionState()
+		Expect(cs.HandshakeComplete).To(BeTrue())
+		Expect(cs.Version).To(Equal(uint16(TLS1_3_VERSION)))
+		Expect(cs.DidResume).To(BeFalse())
+		Expect(cs.CipherSuite).NotTo(BeZero())
+		Expect(cs.CipherSuiteName).To(HavePrefix("TLS_"))
+		Expect(cs.PeerCertificates).To(HaveLen(1))
+		Expect(cs.PeerCertificates[0].Subject.CommonName).To(Equal("bluemix.net"))
+		Expect(cs.VerifiedChains).To(BeEmpty())
+		Expect(cs.OCSPResponse).To(BeEmpty())
+		Expect(cs.TLSUnique).To(BeNil())
+
+		Expect(ss.Version).To(Equal(cs.Version))
+		Expect(ss.CipherSuite).To(Equal(cs.CipherSuite))
+		Expect(ss.CipherSuiteName).To(Equal(cs.CipherSuiteName))
+		Expect(ss.ServerName).To(Equal("example.test"))
+		Expect(ss.PeerCertificates).To(BeEmpty())
+	})
+
+	It("Exports the same keying material at both ends", func() {
+		c, sc := handshake()
+		defer c.Close()
+		defer sc.Close()
+
+		ck, e := c.ConnectionState().ExportKeyingMaterial("EXPERIMENTAL test", []byte("context"), 32)
+		Expect(e).To(BeNil())
+		Expect(ck).To(HaveLen(32))
+
+		sk, e := sc.ConnectionState().ExportKeyingMaterial("EXPERIMENTAL test", []byte("context"), 32)
+		Expect(e).To(BeNil())
+		Expect(sk).To(Equal(ck))
+
+		other, e := c.ConnectionState().ExportKeyingMaterial("EXPERIMENTAL other", []byte("context"), 32)
+		Expect(e).To(BeNil())
+		Expect(other).NotTo(Equal(ck))
+	})
+
+	It("Has the tls-unique channel binding for TLS 1.2", func() {
+		serverCfg.MaxVersion = TLS1_2_VERSION
+		serverCfg.CipherList = "ECDHE-RSA-AES256-GCM-SHA384"
+
+		c, sc := handshake()
+		defer c.Close()
+		defer sc.Close()
+
+		cs, ss := c.ConnectionState(), sc.ConnectionState()
+		Expect(cs.Version).To(Equal(uint16(TLS1_2_VERSION)))
+		Expect(cs.CipherSuite).To(Equal(tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384))
+		Expect(cs.CipherSuiteName).To(Equal("ECDHE-RSA-AES256-GCM-SHA384"))
+		Expect(cs.TLSUnique).To(HaveLen(12))
+		Expect(ss.TLSUnique).To(Equal(cs.TLSUnique))
+	})
+
+	It("Stops exporting once the connection is closed", func() {
+		c, sc := handshake()
+		defer sc.Close()
+
+		state := c.ConnectionState()
+		c.Close()
+		_, e := state.ExportKeyingMaterial("EXPERIMENTAL test", nil, 32)
+		Expect(e).To(HaveOccurred())
+	})
+})
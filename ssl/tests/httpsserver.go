@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 func main() {
@@ -14,9 +16,14 @@ func main() {
 
 	d, _ := filepath.Abs(filepath.Dir(os.Args[0]))
 
+	s := &ssl.Server{
+		Addr:        ":8443",
+		ReadTimeout: 1 * time.Second,
+	}
+
 	fmt.Println("Server listening on port 8443")
-	_, e := ssl.ListenAndServeTLS(":8443", filepath.Join(d, "certs/server/server.pem"),
-		filepath.Join(d, "certs/server/server.key"), nil)
+	e := s.ListenAndServeTLS(filepath.Join(d, "certs/server/server.pem"),
+		filepath.Join(d, "certs/server/server.key"))
 
 	if e != nil {
 		panic(e)
@@ -40,6 +47,31 @@ func setup() {
 		res.Write([]byte("Using gorilla/mux"))
 	})
 	ssl.Handle("/mux", r)
+
+	ssl.HandleFunc("/large", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte(strings.Repeat("a", 10000)))
+	})
+
+	ssl.HandleFunc("/nocontent", func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusNoContent)
+	})
+
+	ssl.HandleFunc("/stream", func(res http.ResponseWriter, req *http.Request) {
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(res, "chunk%d;", i)
+			res.(http.Flusher).Flush()
+		}
+	})
+
+	ssl.HandleFunc("/hijack", func(res http.ResponseWriter, req *http.Request) {
+		c, rw, e := res.(http.Hijacker).Hijack()
+		if e != nil {
+			panic(e)
+		}
+		defer c.Close()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		rw.Flush()
+	})
 }
 
 func aloha(res http.ResponseWriter) {
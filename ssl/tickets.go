@@ -0,0 +1,119 @@
+package ssl
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/IBM-Bluemix/golang-openssl-wrapper/crypto"
+)
+
+// DefaultTicketKeyRotation is how often a listener replaces its session
+// ticket keys when Config.TicketKeyRotation is zero.  Tickets stay valid for
+// at least this long, which covers OpenSSL's default session timeout.
+const DefaultTicketKeyRotation = 2 * time.Hour
+
+// TicketKey is a secret from which a server derives the keys that seal and
+// authenticate its session tickets, as in crypto/tls.
+type TicketKey [32]byte
+
+// TicketKeySource supplies the keys a server seals session tickets with.
+// Servers sharing a source, and so its keys, resume each other's sessions.
+// A source may be called from several goroutines at once.
+type TicketKeySource interface {
+	// TicketKeys returns the keys to use from now on.  The first seals new
+	// tickets; tickets sealed with the others are still accepted, and
+	// replaced with ones sealed with the first.  It is called when a
+	// listener starts and then every Config.TicketKeyRotation.
+	TicketKeys() ([]TicketKey, error)
+}
+
+// StaticTicketKeys is a TicketKeySource which always returns the same keys.
+type StaticTicketKeys []TicketKey
+
+// TicketKeys returns the keys in k.
+func (k StaticTicketKeys) TicketKeys() ([]TicketKey, error) {
+	if len(k) == 0 {
+		return nil, errors.New("No session ticket keys")
+	}
+	return k, nil
+}
+
+// randomTicketKeys is the source of a listener with no
+// Config.SessionTicketKeys.  Every call makes a new key and keeps the one
+// before it, so tickets outlive one rotation.
+type randomTicketKeys struct {
+	mu   sync.Mutex
+	keys []TicketKey
+}
+
+func (r *randomTicketKeys) TicketKeys() ([]TicketKey, error) {
+	var key TicketKey
+	if _, err := rand.Read(key[:]); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.keys = append([]TicketKey{key}, r.keys...)
+	if len(r.keys) > 2 {
+		r.keys = r.keys[:2]
+	}
+	return r.keys, nil
+}
+
+// ticketKeysWire fetches keys from source and derives the name, AES-128 key
+// and HMAC-SHA256 key of each, 16 bytes apiece, in the form
+// SSL_CTX_set_ticket_keys takes.
+func ticketKeysWire(source TicketKeySource) (string, error) {
+	keys, err := source.TicketKeys()
+	if err != nil {
+		return "", err
+	}
+	if len(keys) == 0 {
+		return "", errors.New("No session ticket keys")
+	}
+
+	wire := make([]byte, 0, len(keys)*48)
+	for _, k := range keys {
+		/* The same derivation as crypto/tls */
+		hashed := sha512.Sum512(k[:])
+		wire = append(wire, hashed[:48]...)
+	}
+	return string(wire), nil
+}
+
+// setTicketKeys makes ctx seal and open session tickets with keys, as
+// returned by ticketKeysWire.
+func setTicketKeys(ctx SSL_CTX, keys string) error {
+	return crypto.WithErrorQueue(func() error {
+		if SSL_CTX_set_ticket_keys(ctx, keys, len(keys)) != 1 {
+			return crypto.NewOpenSSLError("Unable to set session ticket keys")
+		}
+		return nil
+	})
+}
+
+// ticketKeySource returns the source a listener made from cfg rotates its
+// keys with, or nil if tickets are disabled.
+func ticketKeySource(cfg *Config) TicketKeySource {
+	switch {
+	case cfg != nil && cfg.SessionTicketsDisabled:
+		return nil
+	case cfg != nil && cfg.SessionTicketKeys != nil:
+		return cfg.SessionTicketKeys
+	}
+	return &randomTicketKeys{}
+}
+
+// ticketKeyRotation returns how often a listener made from cfg rotates its
+// keys.
+func ticketKeyRotation(cfg *Config) time.Duration {
+	if cfg == nil || cfg.TicketKeyRotation <= 0 {
+		return DefaultTicketKeyRotation
+	}
+	return cfg.TicketKeyRotation
+}
@@ -0,0 +1,201 @@
+package ssl_test
+
+import (
+	. "github.com/IBM-Bluemix/golang-openssl-wrapper/ssl"
+
+	"bufio"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server sessions", func() {
+	var (
+		cache  *ClientSessionCache
+		k1, k2 TicketKey
+	)
+
+	BeforeEach(func() {
+		cache = NewClientSessionCache(0, 0)
+		copy(k1[:], "the first session ticket key....")
+		copy(k2[:], "the second session ticket key..")
+	})
+
+	AfterEach(func() {
+		cache.Flush()
+	})
+
+	serverConfig := func() *Config {
+		return &Config{
+			CertFile: "tests/certs/server/server.pem",
+			KeyFile:  "tests/certs/server/server.key",
+		}
+	}
+
+	/* greet reads the server's greeting over c and reports whether the session was resumed */
+	greet := func(c HTTPSConn) bool {
+		defer c.Close()
+
+		/* TLS 1.3 tickets arrive ahead of the greeting */
+		line, e := bufio.NewReader(c).ReadString('\n')
+		Expect(e).To(BeNil())
+		Expect(line).To(Equal("hello\n"))
+		return c.ConnectionState().DidResume
+	}
+
+	Context("With a server per connection", func() {
+		/* resumed connects to a server of its own made from cfg, as if to one replica of many */
+		resumed := func(cfg *Config) bool {
+			client, server := net.Pipe()
+			go func() {
+				c, e := NewServerConn(server, cfg)
+				if e != nil {
+					server.Close()
+					return
+				}
+				c.Write([]byte("hello\n"))
+				c.Close()
+			}()
+
+			c, e := Client(client, &Config{InsecureSkipVerify: true, ClientSessionCache: cache})
+			Expect(e).To(BeNil())
+			return greet(c)
+		}
+
+		withKeys := func(keys ...TicketKey) *Config {
+			cfg := serverConfig()
+			cfg.SessionTicketKeys = StaticTicketKeys(keys)
+			return cfg
+		}
+
+		It("Resumes sessions from servers sharing ticket keys", func() {
+			Expect(resumed(withKeys(k1))).To(BeFalse())
+			Expect(resumed(withKeys(k1))).To(BeTrue())
+		})
+
+		It("Refuses tickets sealed with other keys", func() {
+			Expect(resumed(withKeys(k1))).To(BeFalse())
+			Expect(resumed(withKeys(k2))).To(BeFalse())
+		})
+
+		It("Accepts tickets sealed with older keys", func() {
+			Expect(resumed(withKeys(k1))).To(BeFalse())
+			Expect(resumed(withKeys(k2, k1))).To(BeTrue())
+
+			/* The ticket was renewed under the newest key */
+			Expect(resumed(withKeys(k2))).To(BeTrue())
+		})
+
+		It("Requires ticket keys", func() {
+			_, e := NewServerConn(nil, withKeys())
+			Expect(e).To(HaveOccurred())
+		})
+	})
+
+	Context("With a listener", func() {
+		var (
+			cfg *Config
+			l   net.Listener
+		)
+
+		BeforeEach(func() {
+			cfg = serverConfig()
+		})
+
+		JustBeforeEach(func() {
+			var e error
+			l, e = Listen("tcp", "localhost:8456", cfg)
+			Expect(e).To(BeNil())
+
+			go func() {
+				for {
+					c, e := l.Accept()
+					if e != nil {
+						return
+					}
+					go func() {
+						c.Write([]byte("hello\n"))
+						c.Close()
+					}()
+				}
+			}()
+		})
+
+		AfterEach(func() {
+			l.Close()
+		})
+
+		resumed := func(maxVersion int) bool {
+			raw, e := net.Dial("tcp", "localhost:8456")
+			Expect(e).To(BeNil())
+
+			c, e := Client(raw, &Config{
+				InsecureSkipVerify: true,
+				MaxVersion:         maxVersion,
+				ClientSessionCache: cache,
+			})
+			Expect(e).To(BeNil())
+			return greet(c)
+		}
+
+		It("Resumes sessions with keys of its own", func() {
+			Expect(resumed(0)).To(BeFalse())
+			Expect(resumed(0)).To(BeTrue())
+		})
+
+		It("Keeps tickets valid across certificate reloads", func() {
+			Expect(resumed(0)).To(BeFalse())
+			Expect(l.(interface{ ReloadCertificates() error }).ReloadCertificates()).To(Succeed())
+			Expect(resumed(0)).To(BeTrue())
+		})
+
+		It("Accepts tickets for one rotation", func() {
+			rotate := l.(interface{ RotateTicketKeys() error }).RotateTicketKeys
+
+			Expect(resumed(0)).To(BeFalse())
+			Expect(rotate()).To(Succeed())
+			Expect(resumed(0)).To(BeTrue())
+
+			/* Resuming renewed the ticket under the newest key, which two more rotations retire */
+			Expect(rotate()).To(Succeed())
+			Expect(rotate()).To(Succeed())
+			Expect(resumed(0)).To(BeFalse())
+		})
+
+		Context("Rotating on a schedule", func() {
+			BeforeEach(func() {
+				cfg.TicketKeyRotation = 20 * time.Millisecond
+			})
+
+			It("Refuses tickets two rotations old", func() {
+				Expect(resumed(0)).To(BeFalse())
+				time.Sleep(100 * time.Millisecond)
+				Expect(resumed(0)).To(BeFalse())
+			})
+		})
+
+		Context("Without tickets", func() {
+			BeforeEach(func() {
+				cfg.SessionTicketsDisabled = true
+			})
+
+			It("Resumes TLS 1.2 sessions from its cache", func() {
+				Expect(resumed(TLS1_2_VERSION)).To(BeFalse())
+				Expect(resumed(TLS1_2_VERSION)).To(BeTrue())
+			})
+
+			It("Resumes nothing without a cache", func() {
+				cfg.SessionCacheSize = -1
+
+				Expect(resumed(TLS1_2_VERSION)).To(BeFalse())
+				Expect(resumed(TLS1_2_VERSION)).To(BeFalse())
+			})
+
+			It("Has no keys to rotate", func() {
+				Expect(l.(interface{ RotateTicketKeys() error }).RotateTicketKeys()).NotTo(Succeed())
+			})
+		})
+	})
+})